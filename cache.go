@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// To speed up the cold start, we keep parsed .desktop entries, and icons scaled to the size we need, in the cache
+// dir. Cached things are valid as long as the source file modification time doesn't change.
+
+// Bump it whenever the desktopEntry struct changes
+const entryCacheVersion = 1
+
+type cachedEntry struct {
+	ModTime int64        `json:"mtime"`
+	Entry   desktopEntry `json:"entry"`
+}
+
+type entryCache struct {
+	Version int                    `json:"version"`
+	Lang    string                 `json:"lang"`
+	Entries map[string]cachedEntry `json:"entries"`
+	path    string
+	dirty   bool
+}
+
+// nil if the cache dir is unknown
+var entriesCache *entryCache
+
+// loadEntryCache returns the cache read from the path, or an empty one if missing, outdated or broken
+func loadEntryCache(path, lang string) *entryCache {
+	cache := &entryCache{Version: entryCacheVersion, Lang: lang, Entries: make(map[string]cachedEntry), path: path}
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var stored entryCache
+	if err := json.Unmarshal(bytes, &stored); err != nil {
+		log.Warnf("Entry cache %s broken: %s", path, err)
+		return cache
+	}
+	if stored.Version != entryCacheVersion || stored.Lang != lang || stored.Entries == nil {
+		log.Debugf("Entry cache %s outdated", path)
+		return cache
+	}
+
+	cache.Entries = stored.Entries
+	log.Debugf("Loaded %v cached entries from %s", len(cache.Entries), path)
+	return cache
+}
+
+// parse returns the cached entry if the file hasn't changed since, or parses the file and caches the result
+func (c *entryCache) parse(id, path string) (desktopEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return desktopEntry{}, err
+	}
+	modTime := info.ModTime().UnixNano()
+
+	if cached, ok := c.Entries[path]; ok && cached.ModTime == modTime && cached.Entry.DesktopID == id {
+		return cached.Entry, nil
+	}
+
+	entry, err := parseDesktopEntryFile(id, path)
+	if err != nil {
+		c.forget(path)
+		return entry, err
+	}
+	c.Entries[path] = cachedEntry{ModTime: modTime, Entry: entry}
+	c.dirty = true
+	return entry, nil
+}
+
+func (c *entryCache) forget(path string) {
+	if _, ok := c.Entries[path]; ok {
+		delete(c.Entries, path)
+		c.dirty = true
+	}
+}
+
+// prune drops entries of files not in the list
+func (c *entryCache) prune(paths []string) {
+	keep := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		keep[p] = true
+	}
+	for p := range c.Entries {
+		if !keep[p] {
+			c.forget(p)
+		}
+	}
+}
+
+// save writes the cache, if anything changed. We write to a temporary file first, not to leave a broken cache
+// behind, if killed in the middle.
+func (c *entryCache) save() error {
+	if !c.dirty {
+		return nil
+	}
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	log.Debugf("Saved %v entries to %s", len(c.Entries), c.path)
+	return nil
+}
+
+// parseDesktopEntryCached parses the file through the cache, if we have one
+func parseDesktopEntryCached(id, path string) (desktopEntry, error) {
+	if entriesCache == nil {
+		return parseDesktopEntryFile(id, path)
+	}
+	return entriesCache.parse(id, path)
+}
+
+// Icons scaled to the size we need live in <cache dir>/nwg-drawer-icons/<theme>/<size>/
+var iconCacheDir string
+
+// cachedIcon loads the icon through the cache file (see iconCachePath), that is valid as long as it has the same
+// mtime as the source file. May be called from any goroutine.
+func cachedIcon(cached, source string, load func() (*gdkpixbuf.Pixbuf, error)) (*gdkpixbuf.Pixbuf, error) {
+	if cached == "" || source == "" {
+		return load()
+	}
+
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return load()
+	}
+
+	if cachedInfo, err := os.Stat(cached); err == nil && cachedInfo.ModTime().Equal(sourceInfo.ModTime()) {
+		pixbuf, err := gdkpixbuf.NewPixbufFromFile(cached)
+		if err == nil {
+			return pixbuf, nil
+		}
+		log.Debugf("Cached icon %s broken: %s", cached, err)
+	}
+
+	pixbuf, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	createDir(filepath.Dir(cached))
+	if err := pixbuf.Savev(cached, "png", nil, nil); err != nil {
+		log.Debugf("Couldn't cache icon %s: %s", cached, err)
+		return pixbuf, nil
+	}
+	// the cached file is valid as long as it has the same mtime as the source
+	if err := os.Chtimes(cached, sourceInfo.ModTime(), sourceInfo.ModTime()); err != nil {
+		log.Debugf("Couldn't set cached icon mtime: %s", err)
+	}
+	return pixbuf, nil
+}
+
+// iconCachePath returns the cache file path for the icon of the current theme, or "" if we don't cache icons
+func iconCachePath(name string, size int) string {
+	if iconCacheDir == "" {
+		return ""
+	}
+	theme := "default"
+	if settings := gtk.SettingsGetDefault(); settings != nil {
+		if t, ok := settings.ObjectProperty("gtk-icon-theme-name").(string); ok && t != "" {
+			theme = t
+		}
+	}
+	fileName := strings.NewReplacer("/", "%", " ", "_").Replace(name) + ".png"
+	return filepath.Join(iconCacheDir, theme, fmt.Sprintf("%v", size), fileName)
+}
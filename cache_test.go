@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeDesktopFiles(tb testing.TB, dir string, count int) []string {
+	tb.Helper()
+	var paths []string
+	for i := 0; i < count; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("app%v.desktop", i))
+		content := fmt.Sprintf("[Desktop Entry]\nType=Application\nName=App %v\nName[pl]=Aplikacja %v\n"+
+			"Comment=Does things\nIcon=app%v\nExec=app%v %%U\nCategories=Utility;\n\n"+
+			"[Desktop Action new-window]\nName=New Window\nExec=app%v --new-window\n", i, i, i, i, i)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func TestEntryCache(t *testing.T) {
+	dir := t.TempDir()
+	paths := writeDesktopFiles(t, dir, 2)
+	cacheFile := filepath.Join(dir, "entries.json")
+
+	cache := loadEntryCache(cacheFile, "en")
+	for _, p := range paths {
+		if _, err := cache.parse(filepath.Base(p), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache = loadEntryCache(cacheFile, "en")
+	if len(cache.Entries) != 2 {
+		t.Fatalf("expected 2 cached entries, got %v", len(cache.Entries))
+	}
+	if len(loadEntryCache(cacheFile, "pl").Entries) != 0 {
+		t.Error("entries cached for another language should be dropped")
+	}
+
+	// the file changes, and so does its mtime
+	if err := os.WriteFile(paths[0], []byte("[Desktop Entry]\nType=Application\nName=Renamed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(paths[0], later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := cache.parse(filepath.Base(paths[0]), paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "Renamed" {
+		t.Errorf("stale entry returned: %s", entry.Name)
+	}
+
+	cache.prune(paths[1:])
+	if _, ok := cache.Entries[paths[0]]; ok || len(cache.Entries) != 1 {
+		t.Errorf("entry of a removed file not pruned: %v", cache.Entries)
+	}
+}
+
+// Compare with BenchmarkParseDesktopFilesCached, to see what the cache gives us on a cold start
+func BenchmarkParseDesktopFiles(b *testing.B) {
+	dir := b.TempDir()
+	paths := writeDesktopFiles(b, dir, 500)
+	appDirs = []string{dir}
+	entriesCache = nil
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		parseDesktopFiles(paths)
+	}
+}
+
+func BenchmarkParseDesktopFilesCached(b *testing.B) {
+	dir := b.TempDir()
+	paths := writeDesktopFiles(b, dir, 500)
+	appDirs = []string{dir}
+	cacheFile := filepath.Join(b.TempDir(), "entries.json")
+	entriesCache = loadEntryCache(cacheFile, *lang)
+	parseDesktopFiles(paths)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		// as on the program start
+		entriesCache = loadEntryCache(cacheFile, *lang)
+		parseDesktopFiles(paths)
+	}
+	b.StopTimer()
+	entriesCache = nil
+}
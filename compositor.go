@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// compositor talks to the compositor over its IPC socket, instead of running swaymsg, hyprctl or niri msg
+type compositor interface {
+	// Name returns the compositor name, as used with the -wm argument
+	Name() string
+	// Spawn asks the compositor to run the program
+	Spawn(argv []string) error
+	// Outputs lists enabled outputs
+	Outputs() ([]compositorOutput, error)
+	// FocusedOutput returns the name of the output that has the focus
+	FocusedOutput() (string, error)
+}
+
+// compositorOutput holds what we need to match an output with a gdk.Monitor. Geometry is in the layout (logical)
+// coordinates, like the one of gdk.Monitor.
+type compositorOutput struct {
+	Name    string
+	Make    string
+	Model   string
+	X       int
+	Y       int
+	Width   int
+	Height  int
+	Focused bool
+}
+
+const ipcTimeout = time.Second
+
+// newCompositor returns the IPC backend for the -wm argument value, or nil if we're not running on this compositor
+// or it has no native backend (river, uwsm).
+func newCompositor(name string) compositor {
+	switch name {
+	case "sway":
+		if socket := os.Getenv("SWAYSOCK"); socket != "" {
+			return &swayIPC{socketPath: socket}
+		}
+		log.Warn("Unable to find SWAYSOCK, running command directly")
+	case "hyprland", "Hyprland":
+		if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
+			return &hyprlandIPC{socketPath: hyprlandSocket()}
+		}
+		log.Warn("Unable to find HYPRLAND_INSTANCE_SIGNATURE, running command directly")
+	case "niri":
+		if socket := os.Getenv("NIRI_SOCKET"); socket != "" {
+			return &niriIPC{socketPath: socket}
+		}
+		log.Warn("Unable to find NIRI_SOCKET, running command directly")
+	}
+	return nil
+}
+
+// detectCompositor returns the IPC backend of the compositor we're running on, regardless of the -wm argument
+func detectCompositor() compositor {
+	if socket := os.Getenv("SWAYSOCK"); socket != "" {
+		return &swayIPC{socketPath: socket}
+	}
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
+		return &hyprlandIPC{socketPath: hyprlandSocket()}
+	}
+	if socket := os.Getenv("NIRI_SOCKET"); socket != "" {
+		return &niriIPC{socketPath: socket}
+	}
+	return nil
+}
+
+func focusedOutput(outputs []compositorOutput) (string, error) {
+	for _, o := range outputs {
+		if o.Focused {
+			return o.Name, nil
+		}
+	}
+	return "", errors.New("no focused output")
+}
+
+// matchOutput returns the name of the output of the monitor. Some GDK versions report the connector name (e.g.
+// "DP-1") as the monitor model, so an output of that name wins; then the one occupying the monitor position in the
+// layout, and the one of the same model. Without outputs, e.g. with no compositor IPC, the model is all we have.
+func matchOutput(model string, x, y int, outputs []compositorOutput) (string, bool) {
+	if len(outputs) == 0 {
+		return model, model != ""
+	}
+	for _, o := range outputs {
+		if o.Name == model {
+			return o.Name, true
+		}
+	}
+	for _, o := range outputs {
+		if o.X == x && o.Y == y {
+			return o.Name, true
+		}
+	}
+	for _, o := range outputs {
+		if model != "" && o.Model == model {
+			return o.Name, true
+		}
+	}
+	return "", false
+}
+
+// shellJoin quotes the arguments for the compositors that run commands with `sh -c`
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// sway: i3 IPC, see sway-ipc(7)
+
+const (
+	swayMagic          = "i3-ipc"
+	swayRunCommand     = 0
+	swayGetOutputs     = 3
+	swayHeaderLength   = len(swayMagic) + 8
+	swayMaxReplyLength = 16 << 20
+)
+
+type swayIPC struct {
+	socketPath string
+}
+
+func (s *swayIPC) Name() string {
+	return "sway"
+}
+
+func (s *swayIPC) Spawn(argv []string) error {
+	reply, err := s.roundTrip(swayRunCommand, []byte("exec "+shellJoin(argv)))
+	if err != nil {
+		return err
+	}
+
+	var results []struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	err = json.Unmarshal(reply, &results)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if !r.Success {
+			return fmt.Errorf("sway: %s", r.Error)
+		}
+	}
+	return nil
+}
+
+func (s *swayIPC) Outputs() ([]compositorOutput, error) {
+	reply, err := s.roundTrip(swayGetOutputs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []struct {
+		Name    string `json:"name"`
+		Make    string `json:"make"`
+		Model   string `json:"model"`
+		Active  bool   `json:"active"`
+		Focused bool   `json:"focused"`
+		Rect    struct {
+			X      int `json:"x"`
+			Y      int `json:"y"`
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"rect"`
+	}
+	err = json.Unmarshal(reply, &outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []compositorOutput
+	for _, o := range outputs {
+		// disabled outputs have no gdk.Monitor
+		if !o.Active {
+			continue
+		}
+		result = append(result, compositorOutput{Name: o.Name, Make: o.Make, Model: o.Model, X: o.Rect.X,
+			Y: o.Rect.Y, Width: o.Rect.Width, Height: o.Rect.Height, Focused: o.Focused})
+	}
+	return result, nil
+}
+
+func (s *swayIPC) FocusedOutput() (string, error) {
+	outputs, err := s.Outputs()
+	if err != nil {
+		return "", err
+	}
+	return focusedOutput(outputs)
+}
+
+func (s *swayIPC) roundTrip(messageType uint32, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", s.socketPath, ipcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ipcTimeout))
+
+	message := make([]byte, swayHeaderLength, swayHeaderLength+len(payload))
+	copy(message, swayMagic)
+	binary.NativeEndian.PutUint32(message[len(swayMagic):], uint32(len(payload)))
+	binary.NativeEndian.PutUint32(message[len(swayMagic)+4:], messageType)
+	message = append(message, payload...)
+	_, err = conn.Write(message)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, swayHeaderLength)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:len(swayMagic)]) != swayMagic {
+		return nil, errors.New("sway: invalid reply header")
+	}
+	length := binary.NativeEndian.Uint32(header[len(swayMagic):])
+	if length > swayMaxReplyLength {
+		return nil, fmt.Errorf("sway: reply too long (%v bytes)", length)
+	}
+	if t := binary.NativeEndian.Uint32(header[len(swayMagic)+4:]); t != messageType {
+		return nil, fmt.Errorf("sway: unexpected reply type %v", t)
+	}
+
+	reply := make([]byte, length)
+	_, err = io.ReadFull(conn, reply)
+	return reply, err
+}
+
+// Hyprland: the request socket, see https://wiki.hyprland.org/IPC/
+
+type hyprlandIPC struct {
+	socketPath string
+}
+
+func hyprlandSocket() string {
+	his := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	hyprDir := ""
+	if xdgRuntimeDir != "" {
+		hyprDir = fmt.Sprintf("%s/hypr", xdgRuntimeDir)
+	} else {
+		hyprDir = "/tmp/hypr"
+	}
+
+	return filepath.Join(hyprDir, his, ".socket.sock")
+}
+
+func (h *hyprlandIPC) Name() string {
+	return "Hyprland"
+}
+
+func (h *hyprlandIPC) Spawn(argv []string) error {
+	reply, err := h.request("dispatch exec " + shellJoin(argv))
+	if err != nil {
+		return err
+	}
+	if r := strings.TrimSpace(string(reply)); r != "ok" {
+		return fmt.Errorf("Hyprland: %s", r)
+	}
+	return nil
+}
+
+func (h *hyprlandIPC) Outputs() ([]compositorOutput, error) {
+	reply, err := h.request("j/monitors")
+	if err != nil {
+		return nil, err
+	}
+
+	var monitors []monitor
+	err = json.Unmarshal(reply, &monitors)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []compositorOutput
+	for _, m := range monitors {
+		// width and height are given in pixels, w/o scale and transform applied
+		width, height := m.Width, m.Height
+		if m.Scale > 0 {
+			width, height = int(float64(width)/m.Scale), int(float64(height)/m.Scale)
+		}
+		if m.Transform%2 == 1 {
+			width, height = height, width
+		}
+		result = append(result, compositorOutput{Name: m.Name, Make: m.Make, Model: m.Model, X: m.X, Y: m.Y,
+			Width: width, Height: height, Focused: m.Focused})
+	}
+	return result, nil
+}
+
+func (h *hyprlandIPC) FocusedOutput() (string, error) {
+	outputs, err := h.Outputs()
+	if err != nil {
+		return "", err
+	}
+	return focusedOutput(outputs)
+}
+
+func (h *hyprlandIPC) request(cmd string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", h.socketPath, ipcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ipcTimeout))
+
+	_, err = conn.Write([]byte(cmd))
+	if err != nil {
+		return nil, err
+	}
+
+	// Hyprland closes the connection when the whole reply has been sent
+	return io.ReadAll(conn)
+}
+
+// niri: json requests and replies, one per line, see https://yalter.github.io/niri/niri_ipc/
+
+type niriIPC struct {
+	socketPath string
+}
+
+func (n *niriIPC) Name() string {
+	return "niri"
+}
+
+func (n *niriIPC) Spawn(argv []string) error {
+	request := map[string]interface{}{
+		"Action": map[string]interface{}{
+			"Spawn": map[string]interface{}{"command": argv},
+		},
+	}
+	_, err := n.request(request)
+	return err
+}
+
+func (n *niriIPC) Outputs() ([]compositorOutput, error) {
+	reply, err := n.request("Outputs")
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Outputs map[string]struct {
+			Name    string `json:"name"`
+			Make    string `json:"make"`
+			Model   string `json:"model"`
+			Logical *struct {
+				X      int `json:"x"`
+				Y      int `json:"y"`
+				Width  int `json:"width"`
+				Height int `json:"height"`
+			} `json:"logical"`
+		} `json:"Outputs"`
+	}
+	err = json.Unmarshal(reply, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []compositorOutput
+	for _, o := range response.Outputs {
+		// disabled outputs have no logical geometry
+		if o.Logical == nil {
+			continue
+		}
+		result = append(result, compositorOutput{Name: o.Name, Make: o.Make, Model: o.Model, X: o.Logical.X,
+			Y: o.Logical.Y, Width: o.Logical.Width, Height: o.Logical.Height})
+	}
+	return result, nil
+}
+
+func (n *niriIPC) FocusedOutput() (string, error) {
+	reply, err := n.request("FocusedOutput")
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		FocusedOutput *struct {
+			Name string `json:"name"`
+		} `json:"FocusedOutput"`
+	}
+	err = json.Unmarshal(reply, &response)
+	if err != nil {
+		return "", err
+	}
+	if response.FocusedOutput == nil {
+		return "", errors.New("niri: no focused output")
+	}
+	return response.FocusedOutput.Name, nil
+}
+
+// request sends the request, and returns the content of the "Ok" reply
+func (n *niriIPC) request(request interface{}) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", n.socketPath, ipcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ipcTimeout))
+
+	message, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(append(message, '\n'))
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return nil, err
+	}
+
+	var reply struct {
+		Ok  json.RawMessage `json:"Ok"`
+		Err *string         `json:"Err"`
+	}
+	err = json.Unmarshal(bytes.TrimSpace(line), &reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Err != nil {
+		return nil, fmt.Errorf("niri: %s", *reply.Err)
+	}
+	return reply.Ok, nil
+}
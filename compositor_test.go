@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeServer accepts a single connection on a unix socket, and passes it to the handler
+func fakeServer(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "ipc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+
+	return socketPath
+}
+
+func fakeSway(t *testing.T, reply string, received *string) string {
+	return fakeServer(t, func(conn net.Conn) {
+		header := make([]byte, swayHeaderLength)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		payload := make([]byte, binary.NativeEndian.Uint32(header[len(swayMagic):]))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		*received = string(payload)
+
+		binary.NativeEndian.PutUint32(header[len(swayMagic):], uint32(len(reply)))
+		conn.Write(append(header, reply...))
+	})
+}
+
+func TestSwaySpawn(t *testing.T) {
+	var received string
+	sway := &swayIPC{socketPath: fakeSway(t, `[{"success":true}]`, &received)}
+
+	if err := sway.Spawn([]string{"/usr/bin/env", "-S", "foo 'bar'"}); err != nil {
+		t.Fatal(err)
+	}
+	if received != `exec '/usr/bin/env' '-S' 'foo '\''bar'\'''` {
+		t.Errorf("unexpected command: %s", received)
+	}
+}
+
+func TestSwaySpawnError(t *testing.T) {
+	var received string
+	sway := &swayIPC{socketPath: fakeSway(t, `[{"success":false,"error":"Unknown/invalid command"}]`, &received)}
+
+	err := sway.Spawn([]string{"foo"})
+	if err == nil || !strings.Contains(err.Error(), "Unknown/invalid command") {
+		t.Errorf("expected the sway error, got %v", err)
+	}
+}
+
+func fakeHyprland(t *testing.T, reply string, received *string) string {
+	return fakeServer(t, func(conn net.Conn) {
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		*received = string(buf[:n])
+		conn.Write([]byte(reply))
+	})
+}
+
+func TestHyprlandSpawn(t *testing.T) {
+	var received string
+	hyprland := &hyprlandIPC{socketPath: fakeHyprland(t, "ok", &received)}
+
+	if err := hyprland.Spawn([]string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if received != "dispatch exec 'foo'" {
+		t.Errorf("unexpected command: %s", received)
+	}
+}
+
+func TestHyprlandSpawnError(t *testing.T) {
+	var received string
+	hyprland := &hyprlandIPC{socketPath: fakeHyprland(t, "Invalid dispatcher", &received)}
+
+	err := hyprland.Spawn([]string{"foo"})
+	if err == nil || !strings.Contains(err.Error(), "Invalid dispatcher") {
+		t.Errorf("expected the Hyprland error, got %v", err)
+	}
+}
+
+func fakeNiri(t *testing.T, reply string, received *map[string]interface{}) string {
+	return fakeServer(t, func(conn net.Conn) {
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		json.Unmarshal(line, received)
+		conn.Write([]byte(reply + "\n"))
+	})
+}
+
+func TestNiriSpawn(t *testing.T) {
+	var received map[string]interface{}
+	niri := &niriIPC{socketPath: fakeNiri(t, `{"Ok":"Handled"}`, &received)}
+
+	if err := niri.Spawn([]string{"foo", "--bar"}); err != nil {
+		t.Fatal(err)
+	}
+	command := received["Action"].(map[string]interface{})["Spawn"].(map[string]interface{})["command"]
+	if len(command.([]interface{})) != 2 {
+		t.Errorf("unexpected request: %v", received)
+	}
+}
+
+func TestNiriSpawnError(t *testing.T) {
+	var received map[string]interface{}
+	niri := &niriIPC{socketPath: fakeNiri(t, `{"Err":"error spawning"}`, &received)}
+
+	err := niri.Spawn([]string{"foo"})
+	if err == nil || !strings.Contains(err.Error(), "error spawning") {
+		t.Errorf("expected the niri error, got %v", err)
+	}
+}
+
+func TestSwayOutputs(t *testing.T) {
+	var received string
+	reply := `[{"name":"HDMI-A-1","active":false,"rect":{"x":0,"y":0,"width":0,"height":0}},
+		{"name":"DP-1","model":"DELL U2415","active":true,"focused":true,"rect":{"x":1920,"y":0,"width":1920,"height":1200}}]`
+	sway := &swayIPC{socketPath: fakeSway(t, reply, &received)}
+
+	outputs, err := sway.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Name != "DP-1" || outputs[0].X != 1920 || !outputs[0].Focused {
+		t.Errorf("unexpected outputs: %+v", outputs)
+	}
+}
+
+func TestHyprlandOutputs(t *testing.T) {
+	var received string
+	reply := `[{"name":"eDP-1","x":0,"y":0,"width":2880,"height":1800,"scale":2,"transform":1}]`
+	hyprland := &hyprlandIPC{socketPath: fakeHyprland(t, reply, &received)}
+
+	outputs, err := hyprland.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != "j/monitors" {
+		t.Errorf("unexpected request: %s", received)
+	}
+	if len(outputs) != 1 || outputs[0].Width != 900 || outputs[0].Height != 1440 {
+		t.Errorf("unexpected outputs: %+v", outputs)
+	}
+}
+
+func TestNiriOutputs(t *testing.T) {
+	var received map[string]interface{}
+	// niri replies with a single line
+	reply := `{"Ok":{"Outputs":{"DP-2":{"name":"DP-2","logical":{"x":-1920,"y":0,"width":1920,"height":1080}},` +
+		`"HDMI-A-1":{"name":"HDMI-A-1","logical":null}}}}`
+	niri := &niriIPC{socketPath: fakeNiri(t, reply, &received)}
+
+	outputs, err := niri.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Name != "DP-2" || outputs[0].X != -1920 {
+		t.Errorf("unexpected outputs: %+v", outputs)
+	}
+}
+
+func TestNiriFocusedOutput(t *testing.T) {
+	var received map[string]interface{}
+	niri := &niriIPC{socketPath: fakeNiri(t, `{"Ok":{"FocusedOutput":{"name":"DP-2","logical":null}}}`, &received)}
+
+	name, err := niri.FocusedOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "DP-2" {
+		t.Errorf("unexpected focused output: %s", name)
+	}
+}
+
+func TestMatchOutput(t *testing.T) {
+	outputs := []compositorOutput{
+		{Name: "DP-1", Model: "DELL U2415", X: 1920, Y: 0},
+		{Name: "eDP-1", Model: "0x1234", X: 0, Y: 0},
+	}
+
+	tests := []struct {
+		model    string
+		x, y     int
+		expected string
+	}{
+		{"eDP-1", 1920, 0, "eDP-1"},
+		{"", 1920, 0, "DP-1"},
+		{"", 0, 0, "eDP-1"},
+		{"DELL U2415", 100, 100, "DP-1"},
+		{"", 100, 100, ""},
+	}
+	for _, test := range tests {
+		name, _ := matchOutput(test.model, test.x, test.y, outputs)
+		if name != test.expected {
+			t.Errorf("matchOutput(%q, %v, %v) = %q, expected %q", test.model, test.x, test.y, name, test.expected)
+		}
+	}
+
+	// no compositor IPC: GDK may report connector names as models
+	if name, ok := matchOutput("HDMI-A-1", 0, 0, nil); !ok || name != "HDMI-A-1" {
+		t.Errorf("expected the model to be used, got %q", name)
+	}
+	if _, ok := matchOutput("", 0, 0, nil); ok {
+		t.Error("expected no match without the model")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The config.json file in the config directory may set any command line argument, by the argument name, e.g.:
+//
+//	{
+//	  "term": "foot",
+//	  "c": 8,
+//	  "profiles": {
+//	    "menu": {"panel": "bottom-left", "pw": 560, "ph": 640}
+//	  }
+//	}
+//
+// Values of the profile selected with -profile override the top-level ones. Arguments given in the command line
+// override both.
+
+// Arguments that only make sense in the command line
+var cliOnlyFlags = []string{"v", "open", "close", "profile"}
+
+// configError points to the place in the config file something is wrong with
+type configError struct {
+	Line int
+	Msg  string
+}
+
+func (e configError) Error() string {
+	return fmt.Sprintf("line %v: %s", e.Line, e.Msg)
+}
+
+// configValue is a single key: value pair, with the line it's been found in
+type configValue struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// loadConfig applies the config file to the command line arguments not given explicitly. If profile != "",
+// the profile values are applied on top of the top-level ones.
+func loadConfig(path, profile string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if profile != "" {
+			log.Errorf("Profile %q requested, but %s couldn't be read: %s", profile, path, err)
+		} else {
+			log.Debugf("No config file: %s", err)
+		}
+		return
+	}
+
+	errs := applyConfig(flag.CommandLine, data, profile)
+	for _, e := range errs {
+		log.Errorf("%s: %s", path, e)
+	}
+	log.Infof("Config loaded from %s", path)
+}
+
+// applyConfig sets the flags of the set that were not given in the command line, and returns all the problems found
+func applyConfig(fs *flag.FlagSet, data []byte, profile string) []error {
+	values, profiles, errs := parseConfig(data)
+
+	if profile != "" {
+		profileValues, ok := profiles[profile]
+		if !ok {
+			errs = append(errs, fmt.Errorf("profile %q not found", profile))
+		}
+		values = append(values, profileValues...)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, v := range values {
+		if isIn(cliOnlyFlags, v.Key) {
+			errs = append(errs, configError{v.Line, fmt.Sprintf("%q may only be given in the command line", v.Key)})
+			continue
+		}
+		if fs.Lookup(v.Key) == nil {
+			errs = append(errs, configError{v.Line, fmt.Sprintf("unknown key %q", v.Key)})
+			continue
+		}
+		if explicit[v.Key] {
+			continue
+		}
+		if err := fs.Set(v.Key, v.Value); err != nil {
+			errs = append(errs, configError{v.Line, fmt.Sprintf("bad value %q for %q: %s", v.Value, v.Key, err)})
+		}
+	}
+
+	return errs
+}
+
+// parseConfig returns the top-level values and the values of all profiles, keeping track of line numbers
+func parseConfig(data []byte) ([]configValue, map[string][]configValue, []error) {
+	profiles := make(map[string][]configValue)
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	values, err := parseConfigObject(dec, data, profiles)
+	if err != nil {
+		return values, profiles, []error{jsonError(err, data)}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return values, profiles, []error{configError{lineAt(data, dec.InputOffset()), "unexpected data after the top-level object"}}
+	}
+
+	return values, profiles, nil
+}
+
+// parseConfigObject reads an object of scalar values. If profiles != nil, the "profiles" key is expected to hold
+// objects of the same kind, that are stored in the map by the profile name.
+func parseConfigObject(dec *json.Decoder, data []byte, profiles map[string][]configValue) ([]configValue, error) {
+	if err := expectDelim(dec, data, '{'); err != nil {
+		return nil, err
+	}
+
+	var values []configValue
+	for dec.More() {
+		key, line, err := nextKey(dec, data)
+		if err != nil {
+			return values, err
+		}
+
+		if profiles != nil && key == "profiles" {
+			if err := expectDelim(dec, data, '{'); err != nil {
+				return values, err
+			}
+			for dec.More() {
+				name, _, err := nextKey(dec, data)
+				if err != nil {
+					return values, err
+				}
+				profiles[name], err = parseConfigObject(dec, data, nil)
+				if err != nil {
+					return values, err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return values, err
+			}
+			continue
+		}
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return values, err
+		}
+		switch v := value.(type) {
+		case string:
+			values = append(values, configValue{key, v, line})
+		case json.Number:
+			values = append(values, configValue{key, v.String(), line})
+		case bool:
+			values = append(values, configValue{key, fmt.Sprintf("%v", v), line})
+		default:
+			return values, configError{line, fmt.Sprintf("%q must be a string, number or boolean", key)}
+		}
+	}
+	_, err := dec.Token()
+	return values, err
+}
+
+func nextKey(dec *json.Decoder, data []byte) (string, int, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return "", 0, err
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", 0, configError{lineAt(data, dec.InputOffset()), "key expected"}
+	}
+	return key, lineAt(data, dec.InputOffset()), nil
+}
+
+func expectDelim(dec *json.Decoder, data []byte, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return configError{lineAt(data, dec.InputOffset()), fmt.Sprintf("%q expected", string(delim))}
+	}
+	return nil
+}
+
+// jsonError adds the line number to errors coming from the json package
+func jsonError(err error, data []byte) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return configError{lineAt(data, syntaxErr.Offset), syntaxErr.Error()}
+	}
+	return err
+}
+
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return strings.Count(string(data[:offset]), "\n") + 1
+}
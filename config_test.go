@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func testFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("term", "foot", "")
+	fs.Uint("c", 6, "")
+	fs.Bool("r", false, "")
+	fs.String("panel", "", "")
+	fs.Bool("v", false, "")
+	return fs
+}
+
+func TestApplyConfig(t *testing.T) {
+	config := `{
+  "term": "kitty",
+  "c": 8,
+  "r": true,
+  "profiles": {
+    "menu": {"panel": "bottom-left", "c": 4}
+  }
+}`
+	fs := testFlagSet()
+	fs.Parse([]string{"-term", "alacritty"})
+
+	errs := applyConfig(fs, []byte(config), "menu")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	expected := map[string]string{"term": "alacritty", "c": "4", "r": "true", "panel": "bottom-left"}
+	for name, value := range expected {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("%s = %q, expected %q", name, got, value)
+		}
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	config := `{
+  "term": "kitty",
+  "colums": 8,
+  "c": "many",
+  "v": true
+}`
+	fs := testFlagSet()
+	errs := applyConfig(fs, []byte(config), "missing")
+
+	expected := []string{`line 3: unknown key "colums"`, `line 4: bad value "many" for "c"`, `line 5: "v" may only be`,
+		`profile "missing" not found`}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v errors, got %v", len(expected), errs)
+	}
+	for _, e := range expected {
+		found := false
+		for _, err := range errs {
+			if strings.HasPrefix(err.Error(), e) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("error %q not reported: %v", e, errs)
+		}
+	}
+	if got := fs.Lookup("term").Value.String(); got != "kitty" {
+		t.Errorf("valid values should still be applied, term = %q", got)
+	}
+}
+
+func TestApplyConfigSyntaxError(t *testing.T) {
+	config := "{\n  \"term\": \"kitty\",\n  \"c\" 8\n}"
+	errs := applyConfig(testFlagSet(), []byte(config), "")
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "line 3:") {
+		t.Errorf("expected a syntax error in line 3, got %v", errs)
+	}
+}
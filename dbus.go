@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// Entries marked with DBusActivatable=true are started by calling the org.freedesktop.Application interface,
+// see https://specifications.freedesktop.org/desktop-entry-spec/latest/dbus.html
+
+const dbusTimeout = 2 * time.Second
+
+// dbusActivation is the org.freedesktop.Application method call starting an entry
+type dbusActivation struct {
+	BusName      string
+	ObjectPath   string
+	Method       string            // Activate, ActivateAction or Open
+	Action       string            // for ActivateAction
+	URIs         []string          // for Open
+	PlatformData map[string]string // passes the activation token to the app
+}
+
+// newDBusActivation returns the call of ActivateAction (if action != ""), Open (if uris given) or Activate on
+// the application the desktop ID belongs to. IDs that aren't valid bus names can't be activated; the error makes
+// us run the Exec line instead.
+func newDBusActivation(desktopID, action string, uris []string, token string) (dbusActivation, error) {
+	busName := strings.TrimSuffix(desktopID, ".desktop")
+	if !validBusName(busName) {
+		return dbusActivation{}, fmt.Errorf("%s is not a valid D-Bus name", busName)
+	}
+	a := dbusActivation{
+		BusName:      busName,
+		ObjectPath:   "/" + strings.NewReplacer(".", "/", "-", "_").Replace(busName),
+		Method:       "Activate",
+		PlatformData: make(map[string]string),
+	}
+	if action != "" {
+		a.Method, a.Action = "ActivateAction", action
+	} else if len(uris) > 0 {
+		a.Method, a.URIs = "Open", uris
+	}
+	if token != "" {
+		a.PlatformData["activation-token"] = token
+		a.PlatformData["desktop-startup-id"] = token
+	}
+	return a, nil
+}
+
+// validBusName tells if the name is a well-known D-Bus name, e.g. "org.gnome.Nautilus"
+func validBusName(name string) bool {
+	elements := strings.Split(name, ".")
+	if len(elements) < 2 || len(name) > 255 {
+		return false
+	}
+	for _, e := range elements {
+		if e == "" || e[0] >= '0' && e[0] <= '9' {
+			return false
+		}
+		for _, c := range e {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// dbusActivate makes the call starting the entry. It returns an error if the name is not activatable, so that we
+// could fall back to Exec.
+func dbusActivate(entry desktopEntry, action string, uris []string, token string) error {
+	a, err := newDBusActivation(entry.DesktopID, action, uris, token)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout)
+	defer cancel()
+
+	conn, err := gio.BusGetSync(ctx, gio.BusTypeSession)
+	if err != nil {
+		return err
+	}
+
+	if !dbusNameActivatable(ctx, conn, a.BusName) {
+		return fmt.Errorf("%s is neither running nor activatable on the session bus", a.BusName)
+	}
+
+	log.Infof("D-Bus activation: %s %s.%s", a.BusName, "org.freedesktop.Application", a.Method)
+
+	// Starting the app may take a while, and we don't need the reply, so we don't wait for it.
+	// The message must leave the process, though, as a non-resident drawer is going to quit in a moment.
+	conn.Call(context.Background(), a.BusName, a.ObjectPath, "org.freedesktop.Application", a.Method, a.params(),
+		nil, gio.DBusCallFlagsNone, -1, nil)
+
+	return conn.FlushSync(ctx)
+}
+
+// params returns the arguments of the method
+func (a dbusActivation) params() *glib.Variant {
+	platformData := dbusPlatformData(a.PlatformData)
+	switch a.Method {
+	case "ActivateAction":
+		return glib.NewVariantTuple([]*glib.Variant{
+			glib.NewVariantString(a.Action),
+			glib.NewVariantArray(glib.NewVariantType("v"), nil),
+			platformData,
+		})
+	case "Open":
+		return glib.NewVariantTuple([]*glib.Variant{glib.NewVariantStrv(a.URIs), platformData})
+	}
+	return glib.NewVariantTuple([]*glib.Variant{platformData})
+}
+
+// dbusNameActivatable checks if the name is owned by a running app, or may be started by the bus
+func dbusNameActivatable(ctx context.Context, conn *gio.DBusConnection, busName string) bool {
+	reply, err := conn.CallSync(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"NameHasOwner", glib.NewVariantTuple([]*glib.Variant{glib.NewVariantString(busName)}),
+		glib.NewVariantType("(b)"), gio.DBusCallFlagsNone, int(dbusTimeout.Milliseconds()))
+	if err == nil && reply.ChildValue(0).Boolean() {
+		return true
+	}
+
+	reply, err = conn.CallSync(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"ListActivatableNames", nil, glib.NewVariantType("(as)"), gio.DBusCallFlagsNone,
+		int(dbusTimeout.Milliseconds()))
+	if err != nil {
+		log.Warnf("Couldn't list activatable D-Bus names: %s", err)
+		return false
+	}
+	return isIn(reply.ChildValue(0).Strv(), busName)
+}
+
+// dbusPlatformData builds the a{sv} dictionary of the platform data
+func dbusPlatformData(data map[string]string) *glib.Variant {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var items []*glib.Variant
+	for _, key := range keys {
+		items = append(items, glib.NewVariantDictEntry(glib.NewVariantString(key),
+			glib.NewVariantVariant(glib.NewVariantString(data[key]))))
+	}
+	return glib.NewVariantArray(glib.NewVariantType("{sv}"), items)
+}
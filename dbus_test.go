@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDBusActivation(t *testing.T) {
+	for _, c := range []struct {
+		desktopID, action string
+		uris              []string
+		token             string
+		expected          dbusActivation
+	}{
+		{"org.gnome.Nautilus.desktop", "", nil, "", dbusActivation{BusName: "org.gnome.Nautilus",
+			ObjectPath: "/org/gnome/Nautilus", Method: "Activate", PlatformData: map[string]string{}}},
+		{"org.gnome.Nautilus.desktop", "new-window", nil, "t0k3n", dbusActivation{BusName: "org.gnome.Nautilus",
+			ObjectPath: "/org/gnome/Nautilus", Method: "ActivateAction", Action: "new-window",
+			PlatformData: map[string]string{"activation-token": "t0k3n", "desktop-startup-id": "t0k3n"}}},
+		{"org.gnome.Text-Editor.desktop", "", []string{"file:///tmp/a.txt"}, "", dbusActivation{
+			BusName: "org.gnome.Text-Editor", ObjectPath: "/org/gnome/Text_Editor", Method: "Open",
+			URIs: []string{"file:///tmp/a.txt"}, PlatformData: map[string]string{}}},
+	} {
+		got, err := newDBusActivation(c.desktopID, c.action, c.uris, c.token)
+		if err != nil {
+			t.Errorf("%s: %s", c.desktopID, err)
+		} else if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.desktopID, c.expected, got)
+		}
+	}
+
+	// these fall back to the Exec line
+	for _, id := range []string{"firefox.desktop", "org.7zip.App.desktop", "org.my app.desktop", "org..App.desktop"} {
+		if _, err := newDBusActivation(id, "", nil, ""); err == nil {
+			t.Errorf("%s: expected an error", id)
+		}
+	}
+}
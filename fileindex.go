@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// The file index keeps paths found in the search dirs in memory, and in the cache dir between runs, so that file
+// search doesn't need to walk the disk. It's built in the background, and kept fresh with fsnotify. Until the
+// first build is done, we search the old way.
+
+// Bump it whenever the fileIndex struct changes
+const fileIndexVersion = 4
+
+// We save the index this long after the last change
+const fileIndexSaveDelay = 10 * time.Second
+
+// Dirs with changed ignore files are indexed again this long after the last change, e.g. once a git checkout is done
+const fileIndexRewalkDelay = time.Second
+
+type fileIndex struct {
+	Version  int                    `json:"version"`
+	Roots    map[string]searchRoot  `json:"roots"`
+	Excluded []string               `json:"excluded"`
+	Hidden   bool                   `json:"hidden"`
+	Ignore   bool                   `json:"ignore_files"`
+	Files    map[string]indexedFile `json:"files"` // by path
+	path     string
+	filter   *searchFilter
+	mu       sync.RWMutex
+	ready    bool
+	closed   bool
+	watcher  *fsnotify.Watcher
+	save     *time.Timer
+	// we only complain once about too many dirs to watch
+	watchLimitHit bool
+}
+
+type indexedFile struct {
+	IsDir   bool  `json:"d,omitempty"`
+	ModTime int64 `json:"m"` // in Unix nanoseconds
+	Size    int64 `json:"s,omitempty"`
+}
+
+func newIndexedFile(info fs.FileInfo) indexedFile {
+	return indexedFile{IsDir: info.IsDir(), ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+}
+
+var (
+	fileIdx       *fileIndex // nil unless -fsindex given
+	fileIndexPath string
+)
+
+// startFileIndex (re)builds the index of the search dirs, if enabled. Must be called on the main loop.
+func startFileIndex() {
+	if !*fsIndex || *noFS || fileIndexPath == "" {
+		return
+	}
+	if fileIdx != nil {
+		fileIdx.close()
+	}
+	fileIdx = openFileIndex(fileIndexPath, searchDirs(), append([]string{}, exclusions...))
+}
+
+// openFileIndex returns the index read from the path, if it's been built for the same roots and exclusions,
+// and starts rebuilding it in the background.
+func openFileIndex(path string, roots map[string]searchRoot, excluded []string) *fileIndex {
+	filter := newSearchFilter(excluded)
+	idx := &fileIndex{Version: fileIndexVersion, Roots: roots, Excluded: excluded, Hidden: filter.hidden,
+		Ignore: filter.ignoreFiles, Files: make(map[string]indexedFile), path: path, filter: filter}
+
+	if bytes, err := os.ReadFile(path); err == nil {
+		var stored struct {
+			Version  int                    `json:"version"`
+			Roots    map[string]searchRoot  `json:"roots"`
+			Excluded []string               `json:"excluded"`
+			Hidden   bool                   `json:"hidden"`
+			Ignore   bool                   `json:"ignore_files"`
+			Files    map[string]indexedFile `json:"files"`
+		}
+		if err := json.Unmarshal(bytes, &stored); err != nil {
+			log.Warnf("File index %s broken: %s", path, err)
+		} else if stored.Version == fileIndexVersion && reflect.DeepEqual(stored.Roots, roots) &&
+			strings.Join(stored.Excluded, "\n") == strings.Join(excluded, "\n") && stored.Hidden == idx.Hidden &&
+			stored.Ignore == idx.Ignore && stored.Files != nil {
+			idx.Files = stored.Files
+			idx.ready = true
+			log.Debugf("Loaded %v indexed files from %s", len(idx.Files), path)
+		} else {
+			log.Debugf("File index %s outdated", path)
+		}
+	}
+
+	var err error
+	idx.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		log.Warnf("Can't watch files to index: %s", err)
+	}
+	go idx.build()
+
+	return idx
+}
+
+func (idx *fileIndex) isReady() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.ready
+}
+
+// build walks all the roots, replaces the index with what's been found, and keeps it fresh from now on
+func (idx *fileIndex) build() {
+	start := time.Now()
+	files := make(map[string]indexedFile)
+	for _, root := range idx.Roots {
+		idx.walk(root, root.Path, files)
+	}
+
+	idx.mu.Lock()
+	if idx.closed {
+		idx.mu.Unlock()
+		return
+	}
+	idx.Files = files
+	idx.ready = true
+	idx.mu.Unlock()
+	log.Infof("Indexed %v files in %v ms", len(files), time.Since(start).Milliseconds())
+
+	if err := idx.write(); err != nil {
+		log.Warnf("Couldn't save file index: %s", err)
+	}
+	if idx.watcher != nil {
+		idx.watch()
+	}
+}
+
+// walk adds the dir content to files, and watches subdirectories
+func (idx *fileIndex) walk(root searchRoot, dir string, files map[string]indexedFile) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, e error) error {
+		if e != nil {
+			return nil
+		}
+		rel := strings.TrimPrefix(path, root.Path)
+		if idx.filter.skip(root.Path, path, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// what's inside of dirs at the depth limit isn't indexed, so there's nothing to watch
+		if d.IsDir() && !root.tooDeep(rel) {
+			if idx.watcher != nil {
+				if err := idx.watcher.Add(path); err != nil {
+					if errors.Is(err, syscall.ENOSPC) {
+						if !idx.watchLimitHit {
+							log.Warnf("Can't watch more dirs, the file index may get stale; "+
+								"consider raising fs.inotify.max_user_watches: %s", err)
+							idx.watchLimitHit = true
+						}
+					} else if !errors.Is(err, fsnotify.ErrClosed) {
+						log.Debugf("Can't watch %s: %s", path, err)
+					}
+				}
+			}
+		}
+		if rel != "" {
+			if info, err := d.Info(); err == nil {
+				files[path] = newIndexedFile(info)
+			}
+		}
+		if d.IsDir() && root.tooDeep(rel) {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
+
+// watch applies changes to the index, until closed
+func (idx *fileIndex) watch() {
+	// dirs to index again, by path
+	rewalks := make(map[string]searchRoot)
+	var rewalk <-chan time.Time
+	for {
+		select {
+		case event, ok := <-idx.watcher.Events:
+			if !ok {
+				return
+			}
+			if idx.apply(event, rewalks) {
+				rewalk = time.After(fileIndexRewalkDelay)
+			}
+		case <-rewalk:
+			for dir, root := range rewalks {
+				idx.rewalk(root, dir)
+			}
+			rewalks = make(map[string]searchRoot)
+			rewalk = nil
+		case err, ok := <-idx.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("File index watcher: %s", err)
+		}
+	}
+}
+
+// apply updates the index with the change. Dirs with changed ignore files are added to rewalks instead, and true
+// is returned for them.
+func (idx *fileIndex) apply(event fsnotify.Event, rewalks map[string]searchRoot) bool {
+	name, root := dirOf(event.Name, idx.Roots)
+	if name == "" || root.tooDeep(strings.TrimPrefix(filepath.Dir(event.Name), root.Path)) {
+		return false
+	}
+
+	if idx.filter.ignoreFiles && isIn(ignoreFileNames, filepath.Base(event.Name)) {
+		rewalks[filepath.Dir(event.Name)] = root
+		return true
+	}
+
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		idx.mu.Lock()
+		// only dirs have anything inside, and going through all the files blocks searches for a while
+		if idx.Files[event.Name].IsDir {
+			idx.removeTree(event.Name)
+		}
+		delete(idx.Files, event.Name)
+		idx.mu.Unlock()
+	}
+
+	if event.Op&fsnotify.Create != 0 {
+		info, err := os.Lstat(event.Name)
+		if err != nil {
+			return false
+		}
+		files := make(map[string]indexedFile)
+		if info.IsDir() {
+			// might have been moved here with some content
+			idx.walk(root, event.Name, files)
+		} else if !idx.filter.skip(root.Path, event.Name, false) {
+			files[event.Name] = newIndexedFile(info)
+		}
+		idx.mu.Lock()
+		for p, f := range files {
+			idx.Files[p] = f
+		}
+		idx.mu.Unlock()
+	}
+
+	if event.Op&fsnotify.Write != 0 {
+		// size and modification time
+		if info, err := os.Lstat(event.Name); err == nil {
+			idx.mu.Lock()
+			if _, ok := idx.Files[event.Name]; ok {
+				idx.Files[event.Name] = newIndexedFile(info)
+			}
+			idx.mu.Unlock()
+		}
+	}
+
+	if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+		idx.scheduleSave()
+	}
+	return false
+}
+
+// rewalk indexes the dir again, as what's excluded in it may have changed
+func (idx *fileIndex) rewalk(root searchRoot, dir string) {
+	idx.filter.forget(dir)
+	files := make(map[string]indexedFile)
+	idx.walk(root, dir, files)
+	idx.mu.Lock()
+	idx.removeTree(dir)
+	for p, f := range files {
+		idx.Files[p] = f
+	}
+	idx.mu.Unlock()
+	idx.scheduleSave()
+}
+
+// removeTree drops everything inside of the dir. Must be called with the lock held.
+func (idx *fileIndex) removeTree(dir string) {
+	prefix := dir + "/"
+	for p := range idx.Files {
+		if strings.HasPrefix(p, prefix) {
+			delete(idx.Files, p)
+		}
+	}
+}
+
+// find is the fileFinder looking up the index. All the matches are passed at once.
+func (idx *fileIndex) find(ctx context.Context, dirs map[string]searchRoot, query fileQuery, _ *searchFilter,
+	found func([]fileMatch)) {
+	var matches []fileMatch
+	now := time.Now()
+
+	idx.mu.RLock()
+	for p, f := range idx.Files {
+		name, root := dirOf(p, dirs)
+		if name == "" || !query.searches(name) {
+			continue
+		}
+		r := query.rank(strings.TrimPrefix(p, root.Path), f.IsDir)
+		if r == 0 {
+			continue
+		}
+		modTime := time.Unix(0, f.ModTime)
+		if query.accepts(modTime, f.Size, f.IsDir, now) {
+			matches = append(matches, fileMatch{Dir: name, Path: p, IsDir: f.IsDir, Rank: r, ModTime: modTime,
+				Size: f.Size})
+		}
+	}
+	idx.mu.RUnlock()
+
+	if ctx.Err() == nil && len(matches) > 0 {
+		found(matches)
+	}
+}
+
+// dirOf returns the name of the dir containing the path, and the dir; an empty name if none
+func dirOf(path string, dirs map[string]searchRoot) (string, searchRoot) {
+	name, root := "", searchRoot{}
+	for n, d := range dirs {
+		if strings.HasPrefix(path, d.Path+"/") && len(d.Path) > len(root.Path) {
+			name, root = n, d
+		}
+	}
+	return name, root
+}
+
+func (idx *fileIndex) scheduleSave() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.closed {
+		return
+	}
+	if idx.save != nil {
+		idx.save.Stop()
+	}
+	idx.save = time.AfterFunc(fileIndexSaveDelay, func() {
+		if err := idx.write(); err != nil {
+			log.Warnf("Couldn't save file index: %s", err)
+		}
+	})
+}
+
+// write saves the index to a temporary file first, not to leave a broken index behind, if killed in the middle.
+// Once closed, the index is not written anymore, as there may be a new one for the same file.
+func (idx *fileIndex) write() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.closed {
+		return nil
+	}
+	bytes, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// close stops watching, e.g. before the index gets replaced with one for other roots
+func (idx *fileIndex) close() {
+	if idx.watcher != nil {
+		idx.watcher.Close()
+	}
+	idx.mu.Lock()
+	idx.closed = true
+	if idx.save != nil {
+		idx.save.Stop()
+	}
+	idx.mu.Unlock()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestFileIndex(t *testing.T) {
+	dirs := writeUserDirs(t)
+	indexFile := filepath.Join(t.TempDir(), "files.json")
+
+	idx := openFileIndex(indexFile, dirs, []string{"node_modules"})
+	waitFor(t, "the index", idx.isReady)
+
+	// the index finds what walking does
+	filter := newSearchFilter([]string{"node_modules"})
+	for _, phrase := range []string{"report", "ext:png", "report type:dir"} {
+		found := foundPaths(idx.find, dirs, phrase, nil)
+		expected := foundPaths(findFiles, dirs, phrase, filter)
+		if len(found) == 0 || !reflect.DeepEqual(found, expected) {
+			t.Errorf("%s: expected %v, got %v", phrase, expected, found)
+		}
+	}
+
+	newFile := filepath.Join(dirs["pictures"].Path, "reports-new.png")
+	if err := os.WriteFile(newFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the new file indexed", func() bool { return len(foundPaths(idx.find, dirs, "report", nil)) == 5 })
+
+	if err := os.WriteFile(newFile, make([]byte, 2048), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the size updated", func() bool { return len(foundPaths(idx.find, dirs, "size:>1k", nil)) == 1 })
+
+	if err := os.RemoveAll(filepath.Join(dirs["documents"].Path, "reports")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the removed dir dropped", func() bool { return len(foundPaths(idx.find, dirs, "report", nil)) == 3 })
+
+	if err := idx.write(); err != nil {
+		t.Fatal(err)
+	}
+	idx.close()
+
+	// ready to use at once, as long as roots and exclusions didn't change
+	idx = openFileIndex(indexFile, dirs, []string{"node_modules"})
+	if !idx.isReady() {
+		t.Error("saved index should be used")
+	}
+	idx.close()
+	idx = openFileIndex(indexFile, dirs, nil)
+	if idx.isReady() {
+		t.Error("index built with other exclusions should not be used")
+	}
+	idx.close()
+}
+
+func TestFileIndexDepth(t *testing.T) {
+	dirs := writeUserDirs(t)
+	documents := dirs["documents"]
+	documents.Depth = 1
+	dirs["documents"] = documents
+
+	idx := openFileIndex(filepath.Join(t.TempDir(), "files.json"), dirs, []string{"node_modules"})
+	defer idx.close()
+	waitFor(t, "the index", idx.isReady)
+
+	// files created past the depth limit aren't indexed, neither are those in new dirs at the limit
+	for _, p := range []string{"reports/2025.odt", "new/report.odt", "report-new.odt"} {
+		p = filepath.Join(documents.Path, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the new file indexed", func() bool {
+		return len(foundPaths(idx.find, dirs, "report-new", nil)) == 1
+	})
+	expected := []string{"/Documents/report-new.odt", "/Documents/report.odt", "/Documents/reports", "/Pictures/report.png"}
+	if got := foundPaths(idx.find, dirs, "report", nil); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestFileIndexIgnoreFiles(t *testing.T) {
+	dirs := writeUserDirs(t)
+	*fsIgnoreFiles = true
+	defer func() { *fsIgnoreFiles = false }()
+
+	idx := openFileIndex(filepath.Join(t.TempDir(), "files.json"), dirs, nil)
+	defer idx.close()
+	waitFor(t, "the index", idx.isReady)
+	if got := foundPaths(idx.find, dirs, "ext:png", nil); len(got) != 2 {
+		t.Fatalf("expected 2 pictures, got %v", got)
+	}
+
+	// rewritten a few times in a row, as during a git checkout
+	gitignore := filepath.Join(dirs["pictures"].Path, ".gitignore")
+	for _, content := range []string{"*.jpg\n", "*.gif\n", "cat.png\n"} {
+		if err := os.WriteFile(gitignore, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the dir indexed again", func() bool {
+		return reflect.DeepEqual(foundPaths(idx.find, dirs, "ext:png", nil), []string{"/Pictures/report.png"})
+	})
+}
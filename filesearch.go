@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v3"
+)
+
+// File search runs in a background goroutine, so that walking a big user dir doesn't freeze the UI. Matches are
+// streamed to the main loop in batches, and the best of them displayed; typing another character cancels the search
+// in progress.
+
+type fileMatch struct {
+	Dir     string // the search dir name, e.g. "documents"
+	Path    string
+	IsDir   bool
+	Rank    int // see fileQuery.rank
+	ModTime time.Time
+	Size    int64
+}
+
+// fileFinder passes files matching the query in the dirs to found, in batches, until done or cancelled
+type fileFinder func(ctx context.Context, dirs map[string]searchRoot, query fileQuery, filter *searchFilter,
+	found func([]fileMatch))
+
+// We pass results to the main loop this often, or in batches of this size, whatever comes first
+const (
+	fileSearchFlushInterval = 50 * time.Millisecond
+	fileSearchBatchSize     = 20
+)
+
+var (
+	// Main loop only
+	fileSearchCancel   context.CancelFunc
+	fileSearchRun      uint
+	fileSearchDone     bool
+	fileSearchPhrase   string // "" while displaying recent files for the empty search box
+	fileSearchQuery    fileQuery
+	fileSearchRecent   map[string]bool       // paths of recent files among matches, not to display them twice
+	fileSearchRoots    map[string]searchRoot // dirs searched by the current run, by name
+	fileSearchMatches  []fileMatch           // all found so far
+	fileSearchLimit    int                   // how many of them to display
+	fileSearchTop      *fileTop              // the best fileSearchLimit of them
+	fileSearchRendered string                // what's displayed at the moment, see renderFileResults
+	fileResults        *fileResultView       // children of fileSearchResultFlowBox
+)
+
+// fileResultView keeps track of children of the result FlowBox during a run. Children are added as matches make it
+// to the top, and stay until the run ends; the filter and sort functions decide which are displayed, and where.
+// This way thumbnails aren't looked up again, and the focus stays where it was, when more matches arrive.
+type fileResultView struct {
+	query    fileQuery
+	children map[uintptr]fileResultChild // by native FlowBoxChild
+	added    map[string]bool             // paths of matches, and names of dirs with the header, having a child
+	hasMore  bool                        // whether the "Show more" button has been added
+	shown    map[string]bool             // paths of matches displayed
+	dirs     map[string]int              // dirs displayed, in order
+	more     bool                        // whether "Show more" is displayed
+}
+
+// fileResultChild is what a child of the result FlowBox displays: a match, a dir header, or the "Show more" button
+type fileResultChild struct {
+	header bool
+	more   bool
+	match  fileMatch // just the Dir for headers
+}
+
+func newFileResultView(query fileQuery) *fileResultView {
+	return &fileResultView{query: query, children: make(map[uintptr]fileResultChild), added: make(map[string]bool)}
+}
+
+// update sets which children to display, in the order of top matches (as of topFileMatches)
+func (v *fileResultView) update(top []fileMatch, more bool) {
+	v.shown = make(map[string]bool)
+	v.dirs = make(map[string]int)
+	for _, match := range top {
+		v.shown[match.Path] = true
+		if _, ok := v.dirs[match.Dir]; !ok {
+			v.dirs[match.Dir] = len(v.dirs)
+		}
+	}
+	v.more = more
+}
+
+// count returns how many children are displayed
+func (v *fileResultView) count() int {
+	n := len(v.shown) + len(v.dirs)
+	if v.more {
+		n++
+	}
+	return n
+}
+
+func (v *fileResultView) displays(c fileResultChild) bool {
+	switch {
+	case c.more:
+		return v.more
+	case c.header:
+		_, ok := v.dirs[c.match.Dir]
+		return ok
+	}
+	return v.shown[c.match.Path]
+}
+
+// compare puts dirs in order, each header before matches of the dir, and "Show more" last
+func (v *fileResultView) compare(a, b fileResultChild) int {
+	if a.more != b.more {
+		if a.more {
+			return 1
+		}
+		return -1
+	}
+	if da, db := v.dirIndex(a.match.Dir), v.dirIndex(b.match.Dir); da != db {
+		return da - db
+	}
+	if a.header != b.header {
+		if a.header {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case v.query.less(a.match, b.match):
+		return -1
+	case v.query.less(b.match, a.match):
+		return 1
+	}
+	return 0
+}
+
+// dirIndex returns the position of the dir among those displayed; dirs not displayed go last
+func (v *fileResultView) dirIndex(dir string) int {
+	if i, ok := v.dirs[dir]; ok {
+		return i
+	}
+	return len(v.dirs)
+}
+
+// searchRoot is a dir to search. Besides the XDG user dirs, these are defined in the search-roots.json file.
+type searchRoot struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth,omitempty"` // how many levels down to search, 0 for no limit
+	Icon  string `json:"icon,omitempty"`
+	Name  string `json:"name,omitempty"` // displayed in the results header instead of the dir name
+}
+
+// tooDeep tells if we shouldn't look inside the dir at the rel path, e.g. "/a/b", if the Depth is limited
+func (r searchRoot) tooDeep(rel string) bool {
+	return r.Depth > 0 && strings.Count(rel, "/") >= r.Depth
+}
+
+var searchRoots []searchRoot
+
+// loadSearchRoots reads the list of additional dirs to search, e.g. [{"path": "~/src"}]
+func loadSearchRoots(path string) ([]searchRoot, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var roots []searchRoot
+	if err := json.Unmarshal(bytes, &roots); err != nil {
+		return nil, err
+	}
+	for i, root := range roots {
+		if strings.HasPrefix(root.Path, "~/") {
+			roots[i].Path = filepath.Join(os.Getenv("HOME"), root.Path[2:])
+		}
+		roots[i].Path = filepath.Clean(roots[i].Path)
+	}
+	return roots, nil
+}
+
+// searchDirs returns all the dirs to search, by name: XDG user dirs but home, and search roots by the Name or
+// the base name
+func searchDirs() map[string]searchRoot {
+	home := userDirsMap["home"]
+	dirs := make(map[string]searchRoot)
+	for name, dir := range userDirsMap {
+		// a user dir set to home is disabled
+		if name != "home" && dir != home {
+			dirs[name] = searchRoot{Path: dir, Icon: userDirIcon(name)}
+		}
+	}
+	for _, root := range searchRoots {
+		name := root.Name
+		if name == "" {
+			name = filepath.Base(root.Path)
+		}
+		if _, ok := dirs[name]; ok {
+			name = root.Path
+		}
+		if root.Icon == "" {
+			root.Icon = "folder"
+		}
+		dirs[name] = root
+	}
+	return dirs
+}
+
+// userDirIcon returns the icon name for the XDG user dir
+func userDirIcon(name string) string {
+	switch name {
+	case "desktop":
+		return "user-desktop"
+	case "documents", "downloads", "music", "pictures", "publicshare", "templates", "videos":
+		return fmt.Sprintf("folder-%s", name)
+	}
+	return "folder"
+}
+
+// findFiles is the fileFinder walking the dirs
+func findFiles(ctx context.Context, dirs map[string]searchRoot, query fileQuery, filter *searchFilter,
+	found func([]fileMatch)) {
+	var batch []fileMatch
+	lastFlush := time.Now()
+	flush := func() {
+		if len(batch) > 0 {
+			found(batch)
+			batch = nil
+		}
+		lastFlush = time.Now()
+	}
+	now := time.Now()
+
+	for name, root := range dirs {
+		if !query.searches(name) {
+			continue
+		}
+		filepath.WalkDir(root.Path, func(path string, d fs.DirEntry, e error) error {
+			if ctx.Err() != nil {
+				return fs.SkipAll
+			}
+			if e != nil {
+				// e.g. permission denied; let's search what we can
+				return nil
+			}
+			// don't search leading part of the path, as e.g. '/home/user/Pictures'
+			toSearch := strings.TrimPrefix(path, root.Path)
+			if toSearch == "" {
+				return nil
+			}
+			if filter.skip(root.Path, path, d.IsDir()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if r := query.rank(toSearch, d.IsDir()); r > 0 {
+				if info, err := d.Info(); err == nil && query.accepts(info.ModTime(), info.Size(), d.IsDir(), now) {
+					batch = append(batch, fileMatch{Dir: name, Path: path, IsDir: d.IsDir(), Rank: r,
+						ModTime: info.ModTime(), Size: info.Size()})
+				}
+			}
+			if len(batch) >= fileSearchBatchSize || time.Since(lastFlush) > fileSearchFlushInterval {
+				flush()
+			}
+			if d.IsDir() && root.tooDeep(toSearch) {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	flush()
+}
+
+// startFileSearch cancels the search in progress, if any, clears results and starts searching for the phrase
+func startFileSearch(phrase string) {
+	stopFileSearch()
+
+	fileSearchPhrase = phrase
+	dirs := searchDirs()
+	fileSearchRoots = map[string]searchRoot{recentDirName: recentDir}
+	for name, root := range dirs {
+		fileSearchRoots[name] = root
+	}
+	fileSearchLimit = *fsLimit
+
+	// "recent:" only searches recent files
+	recentOnly := strings.HasPrefix(strings.ToLower(phrase), "recent:")
+	if recentOnly {
+		phrase = phrase[len("recent:"):]
+	}
+	fileSearchQuery = parseFileQuery(phrase)
+	fileSearchMatches = recentMatches(currentRecentFiles(), fileSearchQuery, time.Now())
+	fileSearchTop = newFileTop(fileSearchQuery, fileSearchLimit)
+	fileSearchTop.add(fileSearchMatches...)
+	fileSearchRecent = make(map[string]bool)
+	for _, m := range fileSearchMatches {
+		fileSearchRecent[m.Path] = true
+	}
+	if recentOnly {
+		fileSearchDone = true
+		renderFileResults()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fileSearchCancel = cancel
+	run := fileSearchRun
+	fileSearchDone = false
+
+	// a copy, as it may change on the main loop in the meantime
+	query := fileSearchQuery
+	filter := newSearchFilter(exclusions)
+
+	var search fileFinder = findFiles
+	if fileIdx != nil && fileIdx.isReady() {
+		search = fileIdx.find
+	}
+
+	go func() {
+		search(ctx, dirs, query, filter, func(matches []fileMatch) {
+			glib.IdleAdd(func() {
+				if run == fileSearchRun {
+					for _, m := range matches {
+						if !fileSearchRecent[m.Path] {
+							fileSearchMatches = append(fileSearchMatches, m)
+							fileSearchTop.add(m)
+						}
+					}
+					renderFileResults()
+				}
+			})
+		})
+		glib.IdleAdd(func() {
+			if run == fileSearchRun && ctx.Err() == nil {
+				fileSearchCancel = nil
+				fileSearchDone = true
+				renderFileResults()
+			}
+		})
+	}()
+}
+
+// showRecentFiles displays files opened recently, while the search box is empty
+func showRecentFiles() {
+	stopFileSearch()
+	if *noFS || *recentLimit <= 0 {
+		return
+	}
+	fileSearchPhrase = ""
+	fileSearchRoots = map[string]searchRoot{recentDirName: recentDir}
+	fileSearchQuery = fileQuery{Recent: true}
+	fileSearchLimit = *recentLimit
+	fileSearchMatches = recentMatches(currentRecentFiles(), fileSearchQuery, time.Now())
+	fileSearchTop = newFileTop(fileSearchQuery, fileSearchLimit)
+	fileSearchTop.add(fileSearchMatches...)
+	fileSearchDone = true
+	renderFileResults()
+}
+
+// stopFileSearch cancels the search in progress, and removes results
+func stopFileSearch() {
+	if fileSearchCancel != nil {
+		fileSearchCancel()
+		fileSearchCancel = nil
+	}
+	// results of the cancelled run still waiting on the main loop will be dropped
+	fileSearchRun++
+	fileSearchMatches = nil
+	fileSearchTop = nil
+	fileSearchRecent = nil
+	fileSearchRendered = ""
+
+	if fileSearchResultFlowBox != nil {
+		fileSearchResultFlowBox.Destroy()
+		fileSearchResultFlowBox = nil
+	}
+	fileResults = nil
+	if fileSearchResultWrapper != nil {
+		fileSearchResultWrapper.Hide()
+	}
+}
+
+// renderFileResults displays the best matches found so far, each dir preceded by its header button
+func renderFileResults() {
+	if fileSearchPhrase != "" {
+		status := fmt.Sprintf("%v results | LMB: xdg-open | RMB: file manager", len(fileSearchMatches))
+		if !fileSearchDone {
+			status = "Searching… " + status
+		} else if len(fileSearchMatches) == 0 {
+			status = "0 results"
+		}
+		statusLabel.SetText(status)
+	}
+
+	top := fileSearchTop.best()
+	more := fileSearchTop.more()
+	rendered := fmt.Sprintf("%v", more)
+	for _, match := range top {
+		rendered += "\n" + match.Path
+	}
+	if rendered == fileSearchRendered {
+		return
+	}
+	fileSearchRendered = rendered
+
+	if len(top) == 0 {
+		fileSearchResultWrapper.Hide()
+		return
+	}
+
+	if fileSearchResultFlowBox == nil {
+		fileSearchResultFlowBox = setUpFileSearchResultContainer()
+	}
+	for _, match := range top {
+		root := fileSearchRoots[match.Dir]
+		if !fileResults.added[match.Dir] {
+			addFileResult(setUpUserDirButton(root.Icon, root.Name, root.Path), fileResultChild{header: true,
+				match: fileMatch{Dir: match.Dir}})
+			fileResults.added[match.Dir] = true
+		}
+		if fileResults.added[match.Path] {
+			continue
+		}
+		var button *gtk.Box
+		if match.Dir == recentDirName {
+			button = setUpRecentFileButton(recentFilesByPath[match.Path])
+		} else {
+			button = setUpUserFileSearchResultButton(strings.TrimPrefix(match.Path, root.Path), match)
+		}
+		if button != nil {
+			addFileResult(button, fileResultChild{match: match})
+		}
+		fileResults.added[match.Path] = true
+	}
+	if more && !fileResults.hasMore {
+		button := gtk.NewButtonWithLabel("Show more")
+		button.SetObjectProperty("name", "show-more-button")
+		button.Connect("clicked", func() {
+			fileSearchLimit += *fsLimit
+			// once per click, so going through all the matches again is fine
+			fileSearchTop = newFileTop(fileSearchQuery, fileSearchLimit)
+			fileSearchTop.add(fileSearchMatches...)
+			renderFileResults()
+		})
+		addFileResult(button, fileResultChild{more: true})
+		fileResults.hasMore = true
+	}
+
+	fileResults.update(top, more)
+	fileSearchResultFlowBox.InvalidateFilter()
+	fileSearchResultFlowBox.InvalidateSort()
+	layOutFileResults()
+}
+
+// addFileResult adds the widget to the result FlowBox; the sort function takes care of the position. The focus goes
+// to buttons inside, not to the FlowBoxChild, which does nothing on Enter.
+func addFileResult(widget gtk.Widgetter, c fileResultChild) {
+	fileSearchResultFlowBox.Add(widget)
+	child := gtk.BaseWidget(widget).Parent().(*gtk.FlowBoxChild)
+	child.SetCanFocus(false)
+	fileResults.children[child.Native()] = c
+}
+
+// openFirstFileResult opens the file displayed first, and returns false if there's none
+func openFirstFileResult() bool {
+	if fileSearchTop == nil {
+		return false
+	}
+	top := fileSearchTop.best()
+	if len(top) == 0 {
+		return false
+	}
+	if top[0].Dir == recentDirName {
+		openRecentFile(recentFilesByPath[top[0].Path])
+	} else {
+		open(top[0].Path, true)
+	}
+	return true
+}
+
+// layOutFileResults splits results into *fsColumns columns, and shows them
+func layOutFileResults() {
+	num := uint(fileResults.count()) / *fsColumns
+	fileSearchResultFlowBox.SetMinChildrenPerLine(num + 1)
+	fileSearchResultFlowBox.SetMaxChildrenPerLine(num + 1)
+
+	fileSearchResultFlowBox.ShowAll()
+	fileSearchResultWrapper.Show()
+}
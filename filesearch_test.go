@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeUserDirs(t *testing.T) map[string]searchRoot {
+	t.Helper()
+	root := t.TempDir()
+	dirs := map[string]searchRoot{
+		"documents": {Path: filepath.Join(root, "Documents")},
+		"pictures":  {Path: filepath.Join(root, "Pictures")},
+	}
+	for _, p := range []string{
+		"Documents/report.odt",
+		"Documents/reports/2024.odt",
+		"Documents/node_modules/report.js",
+		"Pictures/report.png",
+		"Pictures/cat.png",
+	} {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dirs
+}
+
+// foundPaths returns sorted paths found by the finder, relative to the parent of search dirs
+func foundPaths(find fileFinder, dirs map[string]searchRoot, phrase string, filter *searchFilter) []string {
+	var found []string
+	find(context.Background(), dirs, parseFileQuery(phrase), filter, func(matches []fileMatch) {
+		for _, m := range matches {
+			found = append(found, strings.TrimPrefix(m.Path, filepath.Dir(dirs[m.Dir].Path)))
+		}
+	})
+	sort.Strings(found)
+	return found
+}
+
+func TestFindFiles(t *testing.T) {
+	dirs := writeUserDirs(t)
+	filter := newSearchFilter([]string{"node_modules"})
+
+	for phrase, expected := range map[string][]string{
+		"Report": {"/Documents/report.odt", "/Documents/reports", "/Documents/reports/2024.odt",
+			"/Pictures/report.png"},
+		"report type:file in:documents": {"/Documents/report.odt", "/Documents/reports/2024.odt"},
+		"ext:png":                       {"/Pictures/cat.png", "/Pictures/report.png"},
+		"size:>1k":                      nil,
+	} {
+		if got := foundPaths(findFiles, dirs, phrase, filter); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", phrase, expected, got)
+		}
+	}
+}
+
+func TestFindFilesCancelled(t *testing.T) {
+	dirs := writeUserDirs(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	findFiles(ctx, dirs, parseFileQuery("report"), newSearchFilter(nil), func(matches []fileMatch) {
+		t.Errorf("no results expected from a cancelled search, got %v", matches)
+	})
+}
+
+func TestFindFilesDepth(t *testing.T) {
+	dirs := writeUserDirs(t)
+	documents := dirs["documents"]
+	documents.Depth = 1
+	dirs["documents"] = documents
+
+	expected := []string{"/Documents/report.odt", "/Documents/reports", "/Pictures/report.png"}
+	if got := foundPaths(findFiles, dirs, "report", newSearchFilter(nil)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestMapXdgUserDirs(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	content := `# written by xdg-user-dirs-update
+XDG_DESKTOP_DIR="$HOME/"
+XDG_DOCUMENTS_DIR="$HOME/Dokumenty"
+XDG_PUBLICSHARE_DIR="/srv/public"
+XDG_PROJECTS_DIR="$HOME/Projekty"
+`
+	if err := os.WriteFile(filepath.Join(configDir, "user-dirs.dirs"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := mapXdgUserDirs()
+	for name, expected := range map[string]string{
+		"desktop":     "/home/user",
+		"documents":   "/home/user/Dokumenty",
+		"publicshare": "/srv/public",
+		"projects":    "/home/user/Projekty",
+		"templates":   "/home/user/Templates",
+	} {
+		if dirs[name] != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, dirs[name])
+		}
+	}
+}
+
+func TestFileResultView(t *testing.T) {
+	v := newFileResultView(fileQuery{})
+	header := func(dir string) fileResultChild { return fileResultChild{header: true, match: fileMatch{Dir: dir}} }
+	old := fileResultChild{match: fileMatch{Dir: "documents", Path: "/d/old.odt", Rank: 2}}
+	best := fileResultChild{match: fileMatch{Dir: "pictures", Path: "/p/best.png", Rank: 6}}
+	worst := fileResultChild{match: fileMatch{Dir: "pictures", Path: "/p/worst.png", Rank: 1}}
+	more := fileResultChild{more: true}
+	// children in the order they were added
+	children := []fileResultChild{header("documents"), old, more, header("pictures"), worst, best}
+
+	v.update([]fileMatch{best.match, old.match}, true)
+	var displayed []fileResultChild
+	for _, c := range children {
+		if v.displays(c) {
+			displayed = append(displayed, c)
+		}
+	}
+	sort.SliceStable(displayed, func(i, j int) bool { return v.compare(displayed[i], displayed[j]) < 0 })
+	expected := []fileResultChild{header("pictures"), best, header("documents"), old, more}
+	if !reflect.DeepEqual(displayed, expected) {
+		t.Errorf("expected %+v, got %+v", expected, displayed)
+	}
+	if v.count() != len(expected) {
+		t.Errorf("expected count %v, got %v", len(expected), v.count())
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"github.com/diamondburned/gotk4/pkg/gtk/v3"
+)
+
+// The keyboard focus moves between sections: pinned items, the category bar, the app grid, file search results
+// and the power bar. Arrow keys move it to the nearest item in that direction, and on to the section above or below
+// at the edge. Tab and Shift+Tab jump between sections; the search entry sits between the last and the first one.
+// Typing goes to the search entry wherever the focus is, and Enter there launches the best match.
+
+type focusSection int
+
+const (
+	sectionPinned focusSection = iota
+	sectionCategories
+	sectionApps
+	sectionFiles
+	sectionPower
+)
+
+// Tab goes through sections in this order
+var focusOrder = []focusSection{sectionPinned, sectionCategories, sectionApps, sectionFiles, sectionPower}
+
+// Up and Down cross sections in the order they're displayed
+var focusLayout = []focusSection{sectionCategories, sectionPinned, sectionApps, sectionFiles, sectionPower}
+
+type focusDirection int
+
+const (
+	focusUp focusDirection = iota
+	focusDown
+	focusLeft
+	focusRight
+)
+
+// focusRect is the position and size of an item, relative to the window
+type focusRect struct {
+	X, Y, W, H int
+}
+
+// nearestInDirection returns the index of the rect the focus moves to from the current one, or -1 if there's none
+// in the direction. Of the rects closest along the direction, e.g. in the next row, the one best lined up wins.
+func nearestInDirection(rects []focusRect, current focusRect, dir focusDirection) int {
+	gaps := make([]int, len(rects))
+	offsets := make([]int, len(rects))
+	minGap := -1
+	for i, r := range rects {
+		switch dir {
+		case focusUp:
+			gaps[i], offsets[i] = current.Y-(r.Y+r.H), (r.X+r.W/2)-(current.X+current.W/2)
+		case focusDown:
+			gaps[i], offsets[i] = r.Y-(current.Y+current.H), (r.X+r.W/2)-(current.X+current.W/2)
+		case focusLeft:
+			gaps[i], offsets[i] = current.X-(r.X+r.W), (r.Y+r.H/2)-(current.Y+current.H/2)
+		case focusRight:
+			gaps[i], offsets[i] = r.X-(current.X+current.W), (r.Y+r.H/2)-(current.Y+current.H/2)
+		}
+		if offsets[i] < 0 {
+			offsets[i] = -offsets[i]
+		}
+		if gaps[i] >= 0 && (minGap == -1 || gaps[i] < minGap) {
+			minGap = gaps[i]
+		}
+	}
+	if minGap == -1 {
+		return -1
+	}
+
+	// items of a row may differ in size a bit
+	tolerance := current.H / 2
+	if dir == focusLeft || dir == focusRight {
+		tolerance = current.W / 2
+	}
+	best := -1
+	for i := range rects {
+		if gaps[i] < 0 || gaps[i] > minGap+tolerance {
+			continue
+		}
+		if best == -1 || offsets[i] < offsets[best] || offsets[i] == offsets[best] && gaps[i] < gaps[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// firstRect returns the index of the top left rect, or -1 if there are none
+func firstRect(rects []focusRect) int {
+	first := -1
+	for i, r := range rects {
+		if first == -1 || r.Y < rects[first].Y || r.Y == rects[first].Y && r.X < rects[first].X {
+			first = i
+		}
+	}
+	return first
+}
+
+// stepSection returns the index of the section step away from the current one, out of n, or -1 for the search
+// entry. The current index is -1 for the search entry, too.
+func stepSection(current, step, n int) int {
+	// the entry goes last, as if it was the section n
+	if current == -1 {
+		current = n
+	}
+	next := (current + step) % (n + 1)
+	if next < 0 {
+		next += n + 1
+	}
+	if next == n {
+		return -1
+	}
+	return next
+}
+
+// sectionRoot returns the widget holding items of the section, or nil if it doesn't exist
+func sectionRoot(s focusSection) gtk.Widgetter {
+	switch s {
+	case sectionPinned:
+		if pinnedFlowBox != nil {
+			return pinnedFlowBox
+		}
+	case sectionCategories:
+		if categoriesWrapper != nil {
+			return categoriesWrapper
+		}
+	case sectionApps:
+		if appFlowBox != nil {
+			return appFlowBox
+		}
+	case sectionFiles:
+		if fileSearchResultFlowBox != nil {
+			return fileSearchResultFlowBox
+		}
+	case sectionPower:
+		if powerButtonsWrapper != nil {
+			return powerButtonsWrapper
+		}
+	}
+	return nil
+}
+
+// displayed tells if the widget and all its ancestors are shown
+func displayed(w *gtk.Widget) bool {
+	for {
+		if !w.IsVisible() || !w.ChildVisible() {
+			return false
+		}
+		parent := w.Parent()
+		if parent == nil {
+			return true
+		}
+		w = gtk.BaseWidget(parent)
+	}
+}
+
+// focusables appends focusable widgets inside of the widget to items, in the container order
+func focusables(w gtk.Widgetter, items []*gtk.Widget) []*gtk.Widget {
+	widget := gtk.BaseWidget(w)
+	if !widget.IsVisible() || !widget.ChildVisible() || !widget.IsSensitive() {
+		return items
+	}
+	if widget.CanFocus() {
+		return append(items, widget)
+	}
+	if container, ok := w.(interface{ Children() []gtk.Widgetter }); ok {
+		for _, child := range container.Children() {
+			items = focusables(child, items)
+		}
+	}
+	return items
+}
+
+// sectionItems returns focusable items of the sections, in the given order; sections not displayed or empty are
+// left out
+func sectionItems(order []focusSection) [][]*gtk.Widget {
+	var sections [][]*gtk.Widget
+	for _, s := range order {
+		root := sectionRoot(s)
+		if root == nil || !displayed(gtk.BaseWidget(root)) {
+			continue
+		}
+		if items := focusables(root, nil); len(items) > 0 {
+			sections = append(sections, items)
+		}
+	}
+	return sections
+}
+
+func rectOf(w *gtk.Widget) focusRect {
+	x, y, _ := w.TranslateCoordinates(win, 0, 0)
+	return focusRect{x, y, w.AllocatedWidth(), w.AllocatedHeight()}
+}
+
+func rectsOf(items []*gtk.Widget) []focusRect {
+	rects := make([]focusRect, len(items))
+	for i, item := range items {
+		rects[i] = rectOf(item)
+	}
+	return rects
+}
+
+// focusedItem returns indexes of the section and of the item having the focus, or -1, -1 if none does
+func focusedItem(sections [][]*gtk.Widget) (int, int) {
+	focused := win.Focus()
+	if focused == nil {
+		return -1, -1
+	}
+	native := gtk.BaseWidget(focused).Native()
+	for i, items := range sections {
+		for j, item := range items {
+			if item.Native() == native {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// focusFirst focuses the top left item, and returns false if there are no items
+func focusFirst(items []*gtk.Widget) bool {
+	if i := firstRect(rectsOf(items)); i >= 0 {
+		items[i].GrabFocus()
+		return true
+	}
+	return false
+}
+
+// focusFirstItem focuses the first pinned item, or the first app if nothing's pinned
+func focusFirstItem() {
+	if sections := sectionItems([]focusSection{sectionPinned, sectionApps}); len(sections) > 0 {
+		focusFirst(sections[0])
+	}
+}
+
+// moveFocus moves the focus by an arrow key, and returns false if GTK should handle the key instead
+func moveFocus(dir focusDirection) bool {
+	sections := sectionItems(focusLayout)
+	si, ii := focusedItem(sections)
+	if si == -1 {
+		// arrows move the cursor in the search entry, but Down leaves it for the best match
+		if dir != focusDown || !searchEntry.IsFocus() {
+			return false
+		}
+		return focusBestMatch()
+	}
+
+	items := sections[si]
+	current := rectOf(items[ii])
+	if i := nearestInDirection(rectsOf(items), current, dir); i >= 0 {
+		items[i].GrabFocus()
+		return true
+	}
+
+	// at the edge of the section
+	switch {
+	case dir == focusUp && si == 0:
+		searchEntry.GrabFocusWithoutSelecting()
+	case dir == focusUp || dir == focusDown && si < len(sections)-1:
+		if dir == focusUp {
+			items = sections[si-1]
+		} else {
+			items = sections[si+1]
+		}
+		if i := nearestInDirection(rectsOf(items), current, dir); i >= 0 {
+			items[i].GrabFocus()
+		} else {
+			// e.g. the app grid scrolled, so that items nearby are out of view
+			focusFirst(items)
+		}
+	}
+	return true
+}
+
+// focusSectionStep focuses the first item of the section step away (1 for Tab, -1 for Shift+Tab)
+func focusSectionStep(step int) bool {
+	sections := sectionItems(focusOrder)
+	si, _ := focusedItem(sections)
+	if next := stepSection(si, step, len(sections)); next >= 0 {
+		focusFirst(sections[next])
+	} else {
+		searchEntry.GrabFocusWithoutSelecting()
+	}
+	return true
+}
+
+// focusBestMatch focuses the top ranked app, or the first file result if no app matches. With nothing searched,
+// the first item displayed gets the focus.
+func focusBestMatch() bool {
+	if phrase == "" {
+		focusFirstItem()
+		return true
+	}
+	if child := firstVisibleApp(); child != nil {
+		gtk.BaseWidget(child.Child()).GrabFocus()
+		return true
+	}
+	if root := sectionRoot(sectionFiles); root != nil {
+		return focusFirst(focusables(root, nil))
+	}
+	return false
+}
+
+// launchBestMatch launches the top ranked app, or opens the first file result if no app matches. Returns false if
+// there's nothing to launch.
+func launchBestMatch() bool {
+	if results := apps.Results(); len(results) > 0 {
+		launchEntry(results[0], true)
+		return true
+	}
+	return openFirstFileResult()
+}
@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+// gridRects returns rects of n items of 100x80 px, in rows of cols, with 10 px spacing
+func gridRects(n, cols int) []focusRect {
+	rects := make([]focusRect, n)
+	for i := range rects {
+		rects[i] = focusRect{X: (i % cols) * 110, Y: (i / cols) * 90, W: 100, H: 80}
+	}
+	return rects
+}
+
+func TestNearestInDirection(t *testing.T) {
+	grid := gridRects(10, 4)
+	for _, c := range []struct {
+		from     int
+		dir      focusDirection
+		expected int
+	}{
+		{5, focusUp, 1},
+		{5, focusDown, 9},
+		{5, focusLeft, 4},
+		{5, focusRight, 6},
+		{0, focusUp, -1},
+		{0, focusLeft, -1},
+		{3, focusRight, -1},
+		// no item right below, the nearest in the row below then
+		{7, focusDown, 9},
+		{9, focusDown, -1},
+	} {
+		if got := nearestInDirection(grid, grid[c.from], c.dir); got != c.expected {
+			t.Errorf("from %v in direction %v: expected %v, got %v", c.from, c.dir, c.expected, got)
+		}
+	}
+
+	// from the app grid, down to file results in 2 columns, and back up
+	files := []focusRect{{0, 400, 200, 30}, {0, 430, 200, 30}, {220, 400, 200, 30}, {220, 430, 200, 30}}
+	if got := nearestInDirection(files, grid[6], focusDown); got != 2 {
+		t.Errorf("expected the top of the 2nd column, got %v", got)
+	}
+	if got := nearestInDirection(grid, files[2], focusUp); got != 9 {
+		t.Errorf("expected the last app, got %v", got)
+	}
+}
+
+func TestFirstRect(t *testing.T) {
+	if got := firstRect(nil); got != -1 {
+		t.Errorf("expected -1, got %v", got)
+	}
+	// e.g. power buttons packed at the end, in reverse order
+	rects := []focusRect{{300, 0, 50, 50}, {200, 0, 50, 50}, {100, 0, 50, 50}}
+	if got := firstRect(rects); got != 2 {
+		t.Errorf("expected 2, got %v", got)
+	}
+}
+
+func TestStepSection(t *testing.T) {
+	for _, c := range []struct {
+		current, step, n, expected int
+	}{
+		// -1 is the search entry
+		{-1, 1, 3, 0},
+		{0, 1, 3, 1},
+		{2, 1, 3, -1},
+		{-1, -1, 3, 2},
+		{0, -1, 3, -1},
+		{-1, 1, 0, -1},
+	} {
+		if got := stepSection(c.current, c.step, c.n); got != c.expected {
+			t.Errorf("%+v: got %v", c, got)
+		}
+	}
+}
@@ -9,14 +9,11 @@ require (
 	github.com/expr-lang/expr v1.17.8
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
-	github.com/joshuarubin/go-sway v1.2.0
 	github.com/sirupsen/logrus v1.9.4
 )
 
 require (
 	github.com/KarpelesLab/weak v0.1.1 // indirect
-	github.com/joshuarubin/lifecycle v1.2.1 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
 	go4.org/unsafe/assume-no-moving-gc v0.0.0-20231121144256-b99613f794b6 // indirect
 	golang.org/x/sync v0.20.0 // indirect
 	golang.org/x/sys v0.42.0 // indirect
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/gotk4/pkg/cairo"
+	"github.com/diamondburned/gotk4/pkg/gdk/v3"
+	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// App grid icons are loaded lazily: a button gets a placeholder, and the icon is decoded in the background when
+// the button gets drawn for the first time, which only happens if it's scrolled into view. Loaded icons are kept
+// in memory, so rebuilding the grid on every keystroke doesn't load anything again. File thumbnails are loaded the
+// same way, but not kept: they get regenerated in place when files change, and there may be lots of them.
+
+const iconLoaders = 4
+
+type iconKey struct {
+	name  string
+	size  int
+	scale int
+}
+
+type iconRequest struct {
+	key    iconKey
+	source string
+	cached string
+	keep   bool // in loadedIcons
+}
+
+var (
+	// Main loop only. A nil pixbuf means the icon couldn't be loaded.
+	loadedIcons  = make(map[iconKey]*gdkpixbuf.Pixbuf)
+	pendingIcons = make(map[iconKey][]*gtk.Image)
+
+	iconRequests    = make(chan iconRequest, 256)
+	startIconLoader sync.Once
+)
+
+// lazyIcon returns an image that shows the icon as soon as it gets loaded
+func lazyIcon(icon string, size int) *gtk.Image {
+	scale := 1
+	if win != nil {
+		scale = win.ScaleFactor()
+	}
+	key := iconKey{icon, size, scale}
+
+	if pixbuf, ok := loadedIcons[key]; ok {
+		img := gtk.NewImage()
+		img.SetPixelSize(size)
+		setIcon(img, pixbuf, scale)
+		return img
+	}
+
+	img := gtk.NewImageFromIconName("image-loading", int(gtk.IconSizeDialog))
+	// icon names are displayed in this size
+	img.SetPixelSize(size)
+
+	var handle glib.SignalHandle
+	handle = img.ConnectDraw(func(_ *cairo.Context) bool {
+		img.HandlerDisconnect(handle)
+		requestIcon(key, img)
+		return false
+	})
+
+	return img
+}
+
+// requestIcon finds the icon file, and queues it for loading. Must be called on the main loop.
+func requestIcon(key iconKey, img *gtk.Image) {
+	if pixbuf, ok := loadedIcons[key]; ok {
+		setIcon(img, pixbuf, key.scale)
+		return
+	}
+	if waiting, ok := pendingIcons[key]; ok {
+		pendingIcons[key] = append(waiting, img)
+		return
+	}
+
+	source := iconSource(key.name, key.size*key.scale)
+	if source == "" {
+		// not a file, e.g. a resource built into the theme; GTK needs to load it
+		pixbuf, err := createPixbuf(key.name, key.size*key.scale)
+		if err != nil {
+			log.Warnf("Cannot load icon %q: %v", key.name, err)
+		}
+		loadedIcons[key] = pixbuf
+		setIcon(img, pixbuf, key.scale)
+		return
+	}
+
+	pendingIcons[key] = []*gtk.Image{img}
+	startIconLoader.Do(func() {
+		for i := 0; i < iconLoaders; i++ {
+			go iconLoader()
+		}
+	})
+
+	request := iconRequest{key: key, source: source}
+	// thumbnails are cached already
+	if !isThumbnail(source) {
+		request.cached = iconCachePath(key.name, key.size*key.scale)
+		request.keep = true
+	}
+	// Let's not block the main loop, if the queue is full
+	select {
+	case iconRequests <- request:
+	default:
+		go func() { iconRequests <- request }()
+	}
+}
+
+// iconSource returns the path to the file the icon comes from, or "" if unknown
+func iconSource(icon string, size int) string {
+	if strings.Contains(icon, "/") {
+		return icon
+	}
+	if strings.HasSuffix(icon, ".svg") || strings.HasSuffix(icon, ".png") || strings.HasSuffix(icon, ".xpm") {
+		icon = strings.Split(icon, ".")[0]
+	}
+	info := gtk.IconThemeGetDefault().LookupIcon(icon, size, gtk.IconLookupForceSize)
+	if info == nil {
+		return ""
+	}
+	return info.Filename()
+}
+
+// iconLoader decodes icon files off the main loop
+func iconLoader() {
+	for request := range iconRequests {
+		size := request.key.size * request.key.scale
+		pixbuf, err := cachedIcon(request.cached, request.source, func() (*gdkpixbuf.Pixbuf, error) {
+			return gdkpixbuf.NewPixbufFromFileAtSize(request.source, size, size)
+		})
+		if err != nil {
+			log.Warnf("Cannot load icon %q: %v", request.key.name, err)
+		}
+
+		key, keep := request.key, request.keep
+		glib.IdleAdd(func() {
+			if keep {
+				loadedIcons[key] = pixbuf
+			}
+			for _, img := range pendingIcons[key] {
+				setIcon(img, pixbuf, key.scale)
+			}
+			delete(pendingIcons, key)
+		})
+	}
+}
+
+func setIcon(img *gtk.Image, pixbuf *gdkpixbuf.Pixbuf, scale int) {
+	if pixbuf == nil {
+		img.SetFromIconName("image-missing", int(gtk.IconSizeDialog))
+		return
+	}
+	if scale > 1 {
+		img.SetFromSurface(gdk.CairoSurfaceCreateFromPixbuf(pixbuf, scale, nil))
+	} else {
+		img.SetFromPixbuf(pixbuf)
+	}
+}
+
+// forgetIcons clears the memory cache, e.g. when the icon theme changes
+func forgetIcons() {
+	loadedIcons = make(map[iconKey]*gdkpixbuf.Pixbuf)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// File search exclusions work like .gitignore files: the excluded-dirs file applies to all the search dirs,
+// and optionally .gitignore and .ignore files found inside of them apply to their own directories. The excluded-dirs
+// file may also have "re:" lines, with regular expressions matched against the relative path.
+
+// ignorePattern is a single line of an ignore file
+type ignorePattern struct {
+	negate   bool           // "!" re-includes what previous patterns excluded
+	dirOnly  bool           // trailing "/" matches directories only
+	anchored bool           // with a "/" inside, matched against the path relative to the base; the name otherwise
+	segments []string       // split on "/"; "**" matches any number of segments
+	base     string         // the dir the pattern applies to, relative to the search dir; "" for all of it
+	re       *regexp.Regexp // used instead of segments for "re:" lines
+}
+
+// parseIgnorePattern returns the pattern of the line, and false for blank lines and comments
+func parseIgnorePattern(line, base string) (ignorePattern, bool) {
+	p := ignorePattern{base: base}
+
+	line = strings.TrimRight(line, " \t")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// e.g. "\#file" or "\!file"
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+	p.segments = strings.Split(line, "/")
+	return p, true
+}
+
+// matches tells if the pattern matches the path relative to the search dir, e.g. "a/b/c"
+func (p ignorePattern) matches(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.re != nil {
+		return p.re.MatchString(rel)
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	if !p.anchored {
+		return matchSegments(p.segments, []string{path.Base(rel)})
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+type ignoreRules []ignorePattern
+
+func parseIgnoreRules(lines []string, base string) ignoreRules {
+	var rules ignoreRules
+	for _, line := range lines {
+		if p, ok := parseIgnorePattern(line, base); ok {
+			rules = append(rules, p)
+		}
+	}
+	return rules
+}
+
+// parseExclusionRules parses lines of the excluded-dirs file: ignore patterns, and regular expressions prefixed
+// with "re:", e.g. "re:(^|/)backup-\d+$". Regular expressions may be negated with "!", too.
+func parseExclusionRules(lines []string) ignoreRules {
+	var rules ignoreRules
+	for _, line := range lines {
+		expr := strings.TrimPrefix(line, "!")
+		if !strings.HasPrefix(expr, "re:") {
+			if p, ok := parseIgnorePattern(line, ""); ok {
+				rules = append(rules, p)
+			}
+			continue
+		}
+		re, err := regexp.Compile(strings.TrimPrefix(expr, "re:"))
+		if err != nil {
+			log.Warnf("Invalid exclusion '%s': %s", line, err)
+			continue
+		}
+		rules = append(rules, ignorePattern{negate: expr != line, re: re})
+	}
+	return rules
+}
+
+// ignored tells if the path relative to the search dir is excluded. The last matching pattern decides.
+func (r ignoreRules) ignored(rel string, isDir bool) bool {
+	result := false
+	for _, p := range r {
+		if p.matches(rel, isDir) {
+			result = !p.negate
+		}
+	}
+	return result
+}
+
+// searchFilter decides which paths inside of a search dir to skip
+type searchFilter struct {
+	excluded    ignoreRules
+	hidden      bool // search hidden files too
+	ignoreFiles bool // honor .gitignore and .ignore files
+
+	mu       sync.Mutex
+	dirRules map[string]ignoreRules // rules of ignore files, by dir path
+}
+
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+// newSearchFilter returns the filter for the excluded-dirs file lines, configured by command line arguments
+func newSearchFilter(excluded []string) *searchFilter {
+	return &searchFilter{excluded: parseExclusionRules(excluded), hidden: *fsHidden, ignoreFiles: *fsIgnoreFiles,
+		dirRules: make(map[string]ignoreRules)}
+}
+
+// skip tells if the path inside of the root should not be searched. May be called from any goroutine.
+func (f *searchFilter) skip(root, p string, isDir bool) bool {
+	rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+	if rel == "" {
+		return false
+	}
+	if !f.hidden && strings.HasPrefix(filepath.Base(p), ".") {
+		return true
+	}
+	rules := f.excluded
+	if f.ignoreFiles {
+		// ignore files of the dirs closer to the path go last, so they take precedence
+		dir := ""
+		rules = append(ignoreRules{}, rules...)
+		rules = append(rules, f.rulesOf(root, dir)...)
+		for _, part := range strings.Split(path.Dir(rel), "/") {
+			if part == "." {
+				break
+			}
+			dir = path.Join(dir, part)
+			rules = append(rules, f.rulesOf(root, dir)...)
+		}
+	}
+	return rules.ignored(rel, isDir)
+}
+
+// rulesOf returns rules of ignore files in the dir relative to the root, read on first use
+func (f *searchFilter) rulesOf(root, dir string) ignoreRules {
+	dirPath := filepath.Join(root, dir)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rules, ok := f.dirRules[dirPath]; ok {
+		return rules
+	}
+	var rules ignoreRules
+	for _, name := range ignoreFileNames {
+		if lines, err := loadTextFile(filepath.Join(dirPath, name)); err == nil {
+			rules = append(rules, parseIgnoreRules(lines, dir)...)
+		}
+	}
+	f.dirRules[dirPath] = rules
+	return rules
+}
+
+// forget drops rules of the dir, e.g. if its ignore file has changed
+func (f *searchFilter) forget(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.dirRules, dir)
+}
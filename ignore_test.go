@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules := parseIgnoreRules([]string{
+		"# comment",
+		"build/",
+		"*.log",
+		"!keep.log",
+		"/top",
+		"docs/**/draft-*",
+		`\#hash`,
+	}, "")
+
+	for _, c := range []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"build", true, true},
+		{"a/build", true, true},
+		{"buildings", true, false},
+		{"build", false, false},
+		{"a/debug.log", false, true},
+		{"a/keep.log", false, false},
+		{"top", true, true},
+		{"a/top", true, false},
+		{"docs/draft-1.odt", false, true},
+		{"docs/2024/05/draft-2.odt", false, true},
+		{"a/docs/draft-1.odt", false, false},
+		{"#hash", false, true},
+	} {
+		if got := rules.ignored(c.rel, c.isDir); got != c.ignored {
+			t.Errorf("%s: expected ignored == %v", c.rel, c.ignored)
+		}
+	}
+}
+
+func TestExclusionRules(t *testing.T) {
+	rules := parseExclusionRules([]string{
+		"*.tmp",
+		`re:(^|/)backup-\d{4}$`,
+		"re:^Work/.*\\.(aux|toc)$",
+		"!re:important",
+		"re:([unclosed",
+	})
+
+	for _, c := range []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"a/x.tmp", false, true},
+		{"backup-2024", true, true},
+		{"a/backup-2024", false, true},
+		{"a/backup-2024.odt", false, false},
+		{"a/old-backup-2024", false, false},
+		{"Work/thesis/main.aux", false, true},
+		{"Personal/main.aux", false, false},
+		{"a/important.tmp", false, false},
+		{"([unclosed", false, false},
+	} {
+		if got := rules.ignored(c.rel, c.isDir); got != c.ignored {
+			t.Errorf("%s: expected ignored == %v", c.rel, c.ignored)
+		}
+	}
+	if len(rules) != 4 {
+		t.Errorf("invalid regular expressions should be skipped, got %v rules", len(rules))
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "project"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "project", ".gitignore"), []byte("/out\n*.o\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := newSearchFilter([]string{"node_modules"})
+	filter.ignoreFiles = true
+	for _, c := range []struct {
+		rel   string
+		isDir bool
+		skip  bool
+	}{
+		{"project/out", true, true},
+		{"project/src/main.o", false, true},
+		{"project/src/out", true, false},
+		// .gitignore applies to its own dir only
+		{"out", true, false},
+		{"main.o", false, false},
+		{"project/node_modules", true, true},
+		{".config", true, true},
+		{"project/.gitignore", false, true},
+	} {
+		if got := filter.skip(root, filepath.Join(root, c.rel), c.isDir); got != c.skip {
+			t.Errorf("%s: expected skip == %v", c.rel, c.skip)
+		}
+	}
+
+	filter.hidden = true
+	if filter.skip(root, filepath.Join(root, ".config"), true) {
+		t.Error("hidden dirs should be searched on demand")
+	}
+}
@@ -32,17 +32,14 @@ import (
 const version = "0.7.5"
 
 var (
-	appDirs          []string
-	configDirectory  string
-	dataDirectory    string
-	pinnedFile       string
-	pinned           []string
-	id2entry         map[string]desktopEntry
-	preferredApps    map[string]interface{}
-	exclusions       []string
-	hyprlandMonitors []monitor
-	beenScrolled     bool
-	firstPowerBtn    *gtk.Button
+	appDirs         []string
+	configDirectory string
+	dataDirectory   string
+	pinnedFile      string
+	preferredApps   map[string]interface{}
+	exclusions      []string
+	cssProvider     *gtk.CSSProvider
+	beenScrolled    bool
 )
 
 var categoryNames = [...]string{
@@ -66,16 +63,27 @@ type category struct {
 var categories []category
 
 type desktopEntry struct {
-	DesktopID  string
-	Name       string
-	NameLoc    string
-	Comment    string
-	CommentLoc string
-	Icon       string
-	Exec       string
-	Category   string
-	Terminal   bool
-	NoDisplay  bool
+	DesktopID       string
+	Name            string
+	NameLoc         string
+	Comment         string
+	CommentLoc      string
+	Icon            string
+	Exec            string
+	Category        string
+	Terminal        bool
+	NoDisplay       bool
+	StartupNotify   bool
+	DBusActivatable bool
+	Actions         []desktopAction
+}
+
+type desktopAction struct {
+	ID      string
+	Name    string
+	NameLoc string
+	Icon    string
+	Exec    string
 }
 
 type monitor struct {
@@ -102,32 +110,18 @@ type monitor struct {
 	Vrr        bool    `json:"vrr"`
 }
 
-// slices below will hold DesktopID strings
-var (
-	listUtility            []string
-	listDevelopment        []string
-	listGame               []string
-	listGraphics           []string
-	listInternetAndNetwork []string
-	listOffice             []string
-	listAudioVideo         []string
-	listSystemTools        []string
-	listOther              []string
-)
-
-var desktopEntries []desktopEntry
-
 // UI elements
 var (
 	win                     *gtk.Window
 	resultWindow            *gtk.ScrolledWindow
-	fileSearchResults       []string
 	mathResultWindow        *gtk.Window
 	searchEntry             *gtk.SearchEntry
 	phrase                  string
 	fileSearchResultFlowBox *gtk.FlowBox
 	userDirsMap             map[string]string
 	appFlowBox              *gtk.FlowBox
+	appGridChildren         map[string]*gtk.FlowBoxChild // by desktop ID
+	appGridIDs              map[uintptr]string           // desktop IDs by native FlowBoxChild
 	appHWrapper             *gtk.Box
 	appSearchResultWrapper  *gtk.Box
 	fileSearchResultWrapper *gtk.Box
@@ -137,10 +131,12 @@ var (
 	categoriesWrapper       *gtk.Box
 	catButtons              []*gtk.Button
 	statusLabel             *gtk.Label
+	errorBanner             *gtk.InfoBar
+	errorLabel              *gtk.Label
 	status                  string
-	ignore                  string
 	desktopTrigger          bool
 	pinnedItemsChanged      chan interface{} = make(chan interface{}, 1)
+	showWindowChannel       chan interface{} = make(chan interface{}, 1)
 	inRestore               bool
 )
 
@@ -163,7 +159,7 @@ func validateWm() {
 
 // Flags
 var cssFileName = flag.String("s", "drawer.css", "Styling: css file name")
-var targetOutput = flag.String("o", "", "name of the Output to display the drawer on (sway & Hyprland only)")
+var targetOutput = flag.String("o", "", "name of the Output to display the drawer on, or 'focused' (sway, Hyprland & niri; elsewhere if GDK reports output names)")
 var displayVersion = flag.Bool("v", false, "display Version information")
 var keyboard = flag.Bool("k", false, "set GTK layer shell Keyboard interactivity to 'on-demand' mode")
 var overlay = flag.Bool("ovl", false, "use OVerLay layer")
@@ -182,9 +178,15 @@ var columnsNumber = flag.Uint("c", 6, "number of Columns")
 var itemSpacing = flag.Uint("spacing", 20, "icon spacing")
 var lang = flag.String("lang", "", "force lang, e.g. \"en\", \"pl\"")
 var fileManager = flag.String("fm", "thunar", "File Manager")
-var term = flag.String("term", defaultTermIfBlank(os.Getenv("TERM"), "foot"), "Terminal emulator")
-var wm = flag.String("wm", "", "use swaymsg exec (with 'sway' argument) or hyprctl dispatch exec (with 'hyprland') or riverctl spawn (with 'river') or niri msg action spawn -- (with 'niri') or uwsm app -- (with 'uwsm' for Universal Wayland Session Manager) to launch programs")
+var term = flag.String("term", "", "Terminal emulator (default: $TERMINAL, xdg-terminal-exec, $TERM or foot)")
+var wm = flag.String("wm", "", "launch programs through the compositor IPC (with 'sway', 'hyprland' or 'niri' argument), or riverctl spawn (with 'river') or uwsm app -- (with 'uwsm' for Universal Wayland Session Manager)")
 var nameLimit = flag.Int("fslen", 80, "File Search name LENgth Limit")
+var fsLimit = flag.Int("fsmax", 100, "File Search MAXimum number of results shown before 'Show more'")
+var fsIndex = flag.Bool("fsindex", false, "keep a File Search INDEX in the cache dir, for instant results")
+var fsHidden = flag.Bool("fshidden", false, "search Hidden files and dirs, too")
+var fsIgnoreFiles = flag.Bool("fsignore", false, "honor .gitignore and .ignore files in searched dirs")
+var fsThumbs = flag.Int("fsthumb", 0, "File Search THUMBnail size in pixels, 0 for MIME type icons only")
+var recentLimit = flag.Int("recent", 10, "number of RECENTly used files shown while the search box is empty, 0 for none")
 var noCats = flag.Bool("nocats", false, "Disable filtering by category")
 var noFS = flag.Bool("nofs", false, "Disable file search")
 var resident = flag.Bool("r", false, "Leave the program resident in memory")
@@ -197,11 +199,19 @@ var pbSize = flag.Int("pbsize", 64, "power bar icon size (only works w/ built-in
 var pbUseIconTheme = flag.Bool("pbuseicontheme", false, "use icon theme instead of built-in icons in power bar")
 var closeBtn = flag.String("closebtn", "none", "close button position: 'left' or 'right', 'none' by default")
 var debug = flag.Bool("d", false, "Turn on Debug messages")
+var profile = flag.String("profile", "", "name of the config file Profile to use")
+var panel = flag.String("panel", "", "display as a Panel anchored to: 'top-left', 'top', 'top-right', 'left', 'center', 'right', 'bottom-left', 'bottom' or 'bottom-right', instead of full screen")
+var panelWidth = flag.Int("pw", 640, "Panel Width (ignored if stretched along the top/bottom edge)")
+var panelHeight = flag.Int("ph", 720, "Panel Height (ignored if stretched along the left/right edge)")
 
 func main() {
 	timeStart := time.Now()
 	flag.Parse()
 
+	// Arguments not given in the command line may come from the config file
+	configDirectory = configDir()
+	loadConfig(path.Join(configDirectory, "config.json"), *profile)
+
 	if *debug {
 		log.SetLevel(log.DebugLevel)
 	}
@@ -212,10 +222,11 @@ func main() {
 	}
 
 	validateWm()
+	validatePanel()
+	*columnsNumber = panelColumns()
 
 	// Gentle SIGTERM handler thanks to reiki4040 https://gist.github.com/reiki4040/be3705f307d3cd136e85
 	// v0.2: we also need to support SIGUSR from now on
-	showWindowChannel := make(chan interface{}, 1)
 	signalChan := make(chan os.Signal, 1)
 	const (
 		SIG25 = syscall.Signal(0x25) // Which is SIGRTMIN+3 on Linux, it's not used by the system
@@ -302,6 +313,9 @@ func main() {
 	}
 	defer lockFile.Close()
 
+	if *term == "" {
+		*term = detectTerminal()
+	}
 	log.Infof("term: %s", *term)
 
 	// LANGUAGE
@@ -311,7 +325,6 @@ func main() {
 	log.Info(fmt.Sprintf("lang: %s", *lang))
 
 	// ENVIRONMENT
-	configDirectory = configDir()
 	dataDirectory = dataDir()
 
 	// Placing the drawer config files in the nwg-panel config directory was a mistake.
@@ -351,17 +364,27 @@ func main() {
 
 	// DATA
 	pinnedFile = filepath.Join(cacheDirectory, "nwg-pin-cache")
-	pinned, err = loadTextFile(pinnedFile)
+	pins = newPinStore(pinnedFile, func(id string) bool {
+		_, ok := apps.ByID[id]
+		return ok
+	})
+	err = pins.Load()
 	if err != nil {
-		pinned = nil
-		savePinned()
+		err = pins.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	log.Info(fmt.Sprintf("Found %v pinned items", len(pinned)))
+	log.Info(fmt.Sprintf("Found %v pinned items", len(pins.Items)))
 
 	if !strings.HasPrefix(*cssFileName, "/") {
 		*cssFileName = filepath.Join(configDirectory, *cssFileName)
 	}
 
+	entriesCache = loadEntryCache(filepath.Join(cacheDirectory, "nwg-drawer-entries.json"), *lang)
+	iconCacheDir = filepath.Join(cacheDirectory, "nwg-drawer-icons")
+	fileIndexPath = filepath.Join(cacheDirectory, "nwg-drawer-files.json")
+
 	appDirs = getAppDirs()
 
 	setUpCategories()
@@ -385,6 +408,15 @@ func main() {
 		log.Infof("%s file not found", paFile)
 	}
 
+	// Terminal emulators we don't know, or know wrong, may be defined in the terminals.json file
+	termFile := path.Join(configDirectory, "terminals.json")
+	if pathExists(termFile) {
+		err = loadTerminalProfiles(termFile)
+		if err != nil {
+			log.Warnf("Couldn't load terminal profiles from %s: %s", termFile, err)
+		}
+	}
+
 	// Load user-defined paths excluded from file search
 	exFile := path.Join(configDirectory, "excluded-dirs")
 	if pathExists(exFile) {
@@ -398,6 +430,17 @@ func main() {
 		log.Infof("%s file not found", exFile)
 	}
 
+	// Dirs to search besides the XDG user dirs
+	rootsFile := path.Join(configDirectory, "search-roots.json")
+	if pathExists(rootsFile) {
+		searchRoots, err = loadSearchRoots(rootsFile)
+		if err != nil {
+			log.Warnf("Couldn't load search roots from %s: %s", rootsFile, err)
+		} else {
+			log.Infof("Found %v search roots in %s", len(searchRoots), rootsFile)
+		}
+	}
+
 	// USER INTERFACE
 	gtk.Init()
 
@@ -415,15 +458,11 @@ func main() {
 		log.Infof("User demanded icon theme: %s", *gtkIconTheme)
 	}
 
-	cssProvider := gtk.NewCSSProvider()
-
-	err = cssProvider.LoadFromPath(*cssFileName)
+	err = loadCSS(*cssFileName)
 	if err != nil {
 		log.Errorf("ERROR: %s css file not found or erroneous. Using GTK styling.", *cssFileName)
 	} else {
 		log.Info(fmt.Sprintf("Using style from %s", *cssFileName))
-		screen := gdk.ScreenGetDefault()
-		gtk.StyleContextAddProviderForScreen(screen, cssProvider, gtk.STYLE_PROVIDER_PRIORITY_APPLICATION)
 	}
 
 	win = gtk.NewWindow(gtk.WindowToplevel)
@@ -437,24 +476,13 @@ func main() {
 		gtklayershell.InitForWindow(win)
 		gtklayershell.SetNamespace(win, "nwg-drawer")
 
-		var output2mon map[string]*gdk.Monitor
+		// without -o, the compositor picks the output, also after hotplugging
 		if *targetOutput != "" {
-			// We want to assign layershell to a monitor, but we only know the output name!
-			output2mon, err = mapOutputs()
-			log.Debugf("output2mon: %v", output2mon)
-			if err == nil {
-				mon := output2mon[*targetOutput]
-				gtklayershell.SetMonitor(win, mon)
-
-			} else {
-				log.Errorf("%s", err)
-			}
+			assignToOutput(*targetOutput)
+			watchMonitors()
 		}
 
-		gtklayershell.SetAnchor(win, gtklayershell.LayerShellEdgeBottom, true)
-		gtklayershell.SetAnchor(win, gtklayershell.LayerShellEdgeTop, true)
-		gtklayershell.SetAnchor(win, gtklayershell.LayerShellEdgeLeft, true)
-		gtklayershell.SetAnchor(win, gtklayershell.LayerShellEdgeRight, true)
+		anchorWindow()
 
 		if *overlay {
 			gtklayershell.SetLayer(win, gtklayershell.LayerShellLayerOverlay)
@@ -503,14 +531,10 @@ func main() {
 			}
 			return true
 
-		} else if key.Keyval() == gdk.KEY_Tab {
-			if firstPowerBtn != nil {
-				firstPowerBtn.GrabFocus()
-			}
-
 		} else if key.Keyval() == gdk.KEY_Return || key.Keyval() == gdk.KEY_KP_Enter {
 			s := searchEntry.Text()
-			if s != "" {
+			// buttons having the focus handle Enter themselves
+			if s != "" && searchEntry.IsFocus() {
 				// Check if execute command input
 				if s[0] == ':' {
 					// Make sure there's something to run
@@ -519,11 +543,13 @@ func main() {
 					}
 				} else {
 					// Check if the search box content is an arithmetic expression. If so, display the result
-					// and copy to the clipboard with wl-copy.
+					// and copy to the clipboard with wl-copy. Otherwise, e.g. for a plain number, launch the best match.
 					result, e := expr.Eval(s, nil)
-					if e == nil {
+					if e == nil && fmt.Sprintf("%v", result) != strings.TrimSpace(s) {
 						log.Debugf("Setting up mathemathical operation result window. Operation: %s, result: %v", s, result)
 						mathResultWindow = setUpOperationResultWindow(s, fmt.Sprintf("%v", result))
+					} else {
+						launchBestMatch()
 					}
 				}
 			}
@@ -536,8 +562,20 @@ func main() {
 		//key := &gdk.EventKey{Event: event}
 		key := event.AsKey()
 		switch key.Keyval() {
-		case gdk.KEY_downarrow, gdk.KEY_Up, gdk.KEY_Down, gdk.KEY_Left, gdk.KEY_Right, gdk.KEY_Tab,
-			gdk.KEY_Return, gdk.KEY_Page_Up, gdk.KEY_Page_Down, gdk.KEY_Home, gdk.KEY_End:
+		case gdk.KEY_Tab:
+			return focusSectionStep(1)
+		case gdk.KEY_ISO_Left_Tab:
+			return focusSectionStep(-1)
+		case gdk.KEY_Up:
+			return moveFocus(focusUp)
+		case gdk.KEY_Down:
+			return moveFocus(focusDown)
+		case gdk.KEY_Left:
+			return moveFocus(focusLeft)
+		case gdk.KEY_Right:
+			return moveFocus(focusRight)
+		case gdk.KEY_downarrow, gdk.KEY_Return, gdk.KEY_KP_Enter, gdk.KEY_Page_Up, gdk.KEY_Page_Down,
+			gdk.KEY_Home, gdk.KEY_End:
 			return false
 
 		default:
@@ -556,7 +594,11 @@ func main() {
 	if !wayland() {
 		log.Info("Not Wayland, oh really?")
 		win.SetDecorated(false)
-		win.Maximize()
+		if panelMode() {
+			win.SetDefaultSize(*panelWidth, *panelHeight)
+		} else {
+			win.Maximize()
+		}
 	}
 
 	// Set up UI
@@ -575,6 +617,9 @@ func main() {
 	searchEntry.SetMaxWidthChars(30)
 	searchBoxWrapper.PackStart(searchEntry, true, false, 0)
 
+	errorBanner = setUpErrorBanner()
+	outerVBox.PackStart(errorBanner, false, false, 0)
+
 	if !*noCats {
 		categoriesWrapper = gtk.NewBox(gtk.OrientationHorizontal, 0)
 		categoriesButtonBox := setUpCategoriesButtonBox()
@@ -622,24 +667,22 @@ func main() {
 
 	resultsWrapper := gtk.NewBox(gtk.OrientationVertical, 0)
 	resultWindow.Add(resultsWrapper)
+	// scroll to the focused item
+	resultsWrapper.SetFocusVAdjustment(resultWindow.VAdjustment())
 
 	appSearchResultWrapper = gtk.NewBox(gtk.OrientationVertical, 0)
 	resultsWrapper.PackStart(appSearchResultWrapper, false, false, 0)
-	appFlowBox = setUpAppsFlowBox(nil, "")
+	appFlowBox = setUpAppsFlowBox()
 
-	// Focus 1st pinned item if any, otherwise focus 1st found app icon
-	var button gtk.Widget
-	if len(pinnedFlowBox.Children()) > 0 {
-		button = pinnedFlowBox.ChildAtIndex(0).Widget
-	} else {
-		button = appFlowBox.ChildAtIndex(0).Widget
-	}
-	if err == nil {
-		button.GrabFocus()
-	}
+	// The view follows the model
+	apps.Observe(applyAppQuery)
+	pins.Observe(func() {
+		pinnedFlowBox = setUpPinnedFlowBox()
+	})
 
 	userDirsMap = mapXdgUserDirs()
 	log.Debugf("User dirs map: %s", userDirsMap)
+	startFileIndex()
 
 	placeholder := gtk.NewBox(gtk.OrientationVertical, 0)
 	resultsWrapper.PackStart(placeholder, true, true, 0)
@@ -672,7 +715,6 @@ func main() {
 					btn = powerButton("system-shutdown-symbolic", *pbPoweroff)
 				}
 				powerButtonsWrapper.PackEnd(btn, true, false, 0)
-				firstPowerBtn = btn
 			}
 			if *pbSleep != "" {
 				btn := gtk.NewButton()
@@ -682,7 +724,6 @@ func main() {
 					btn = powerButton("face-yawn-symbolic", *pbSleep)
 				}
 				powerButtonsWrapper.PackEnd(btn, true, false, 0)
-				firstPowerBtn = btn
 			}
 			if *pbReboot != "" {
 				btn := gtk.NewButton()
@@ -692,7 +733,6 @@ func main() {
 					btn = powerButton("system-reboot-symbolic", *pbReboot)
 				}
 				powerButtonsWrapper.PackEnd(btn, true, false, 0)
-				firstPowerBtn = btn
 			}
 			if *pbExit != "" {
 				btn := gtk.NewButton()
@@ -702,7 +742,6 @@ func main() {
 					btn = powerButton("system-log-out-symbolic", *pbExit)
 				}
 				powerButtonsWrapper.PackEnd(btn, true, false, 0)
-				firstPowerBtn = btn
 			}
 			if *pbLock != "" {
 				btn := gtk.NewButton()
@@ -712,7 +751,6 @@ func main() {
 					btn = powerButton("system-lock-screen-symbolic", *pbLock)
 				}
 				powerButtonsWrapper.PackEnd(btn, true, false, 0)
-				firstPowerBtn = btn
 			}
 		}
 	} else {
@@ -730,13 +768,19 @@ func main() {
 
 	if !*noFS {
 		fileSearchResultWrapper.SetSizeRequest(appFlowBox.AllocatedWidth(), 1)
-		fileSearchResultWrapper.Hide()
+		showRecentFiles()
 	}
+	// Focus 1st pinned item if any, otherwise focus 1st app
+	focusFirstItem()
 	if !*noCats {
 		categoriesWrapper.SetSizeRequest(1, categoriesWrapper.AllocatedHeight()*2)
 	}
 	if powerButtonsWrapper != nil {
-		powerButtonsWrapper.SetSizeRequest(300, 1)
+		if panelMode() && *panelWidth < 340 {
+			powerButtonsWrapper.SetSizeRequest(*panelWidth-40, 1)
+		} else {
+			powerButtonsWrapper.SetSizeRequest(300, 1)
+		}
 	}
 	if *resident && win.IsVisible() {
 		win.Hide()
@@ -756,29 +800,29 @@ func main() {
 
 						// Refresh files before displaying the root window
 						// some .desktop file changed
+						checkAppDirs()
 						if desktopTrigger {
 							log.Debug(".desktop file changed")
-							desktopFiles = listDesktopFiles()
-							status = parseDesktopFiles(desktopFiles)
-							appFlowBox = setUpAppsFlowBox(nil, "")
-							desktopTrigger = false
+							refreshApps()
+						}
+
+						// The focus may have moved to another output since we've been shown last time
+						if *targetOutput == "focused" && wayland() {
+							assignToOutput(*targetOutput)
 						}
 
 						// Show window and focus the search box
 						win.ShowAll()
 						if fileSearchResultWrapper != nil {
-							fileSearchResultWrapper.Hide()
+							// recent files may have changed since
+							if phrase == "" {
+								showRecentFiles()
+							} else {
+								fileSearchResultWrapper.Hide()
+							}
 						}
 						// focus 1st element
-						var button gtk.Widget
-						if len(pinnedFlowBox.Children()) > 0 {
-							button = pinnedFlowBox.ChildAtIndex(0).Widget
-						} else {
-							button = appFlowBox.ChildAtIndex(0).Widget
-						}
-						if err == nil {
-							button.GrabFocus()
-						}
+						focusFirstItem()
 					}
 
 					return false
@@ -787,8 +831,11 @@ func main() {
 			case <-pinnedItemsChanged:
 				glib.TimeoutAdd(0, func() bool {
 					log.Debug("pinned file changed")
-					pinned, _ = loadTextFile(pinnedFile)
-					pinnedFlowBox = setUpPinnedFlowBox()
+					// observers rebuild the pinned items if needed
+					err := pins.Load()
+					if err != nil {
+						log.Warnf("Couldn't load pinned items: %s", err)
+					}
 
 					return false
 				})
@@ -797,6 +844,7 @@ func main() {
 	}()
 
 	go watchFiles()
+	watchIconTheme()
 
 	gtk.Main()
 }
@@ -829,6 +877,10 @@ func restoreStateAndHide() {
 		mathResultWindow = nil
 	}
 
+	if errorBanner != nil {
+		errorBanner.Hide()
+	}
+
 	// Hide the window via glib.IdleAdd to avoid calling Hide() outside the main thread
 	if win != nil {
 		winPtr := win
@@ -847,8 +899,8 @@ func restoreStateAndHide() {
 		searchEntry.SetText("")
 	}
 
-	// Rebuild FlowBox
-	appFlowBox = setUpAppsFlowBox(nil, "")
+	// Show all the apps
+	apps.SetQuery("", "")
 
 	// Reset category buttons
 	for _, btn := range catButtons {
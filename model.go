@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The model layer: app entries, categories, the search query, pinned items and launch requests. Nothing in here
+// touches GTK, so that it could be tested without a display. The view (uicomponents.go) observes changes.
+
+// appModel holds all the apps we know, and the query deciding which of them the grid displays
+type appModel struct {
+	Entries    []desktopEntry          // sorted by the localized name, including NoDisplay ones
+	ByID       map[string]desktopEntry // by desktop ID
+	Categories map[string][]string     // desktop IDs by the category name (see categoryNames)
+	query      appQuery
+	observers  []func()
+}
+
+// appQuery selects apps of the Category ("" for all), matching the Phrase
+type appQuery struct {
+	Category string
+	Phrase   string
+}
+
+var apps = newAppModel()
+
+func newAppModel() *appModel {
+	return &appModel{ByID: make(map[string]desktopEntry), Categories: make(map[string][]string)}
+}
+
+// Observe registers a function to be called whenever the query changes
+func (m *appModel) Observe(f func()) {
+	m.observers = append(m.observers, f)
+}
+
+func (m *appModel) notify() {
+	for _, f := range m.observers {
+		f()
+	}
+}
+
+// SetEntries replaces the entries with the parsed files. If the same desktop ID is found in more than one dir,
+// the one from the dir that comes first wins. Returns a summary to display.
+func (m *appModel) SetEntries(entriesByPath map[string]desktopEntry, dirs []string) string {
+	paths := make([]string, 0, len(entriesByPath))
+	for p := range entriesByPath {
+		paths = append(paths, p)
+	}
+	dirIndex := func(p string) int {
+		for i, d := range dirs {
+			if filepath.Dir(p) == d {
+				return i
+			}
+		}
+		return len(dirs)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := dirIndex(paths[i]), dirIndex(paths[j])
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+
+	m.Entries = nil
+	m.ByID = make(map[string]desktopEntry)
+	m.Categories = make(map[string][]string)
+
+	skipped := 0
+	hidden := 0
+	for _, file := range paths {
+		entry := entriesByPath[file]
+		if _, ok := m.ByID[entry.DesktopID]; ok {
+			skipped++
+			continue
+		}
+
+		if entry.NoDisplay {
+			hidden++
+			// We still need hidden entries, so `continue` is disallowed here
+			// Fixes bug introduced in #19
+		}
+
+		m.ByID[entry.DesktopID] = entry
+		m.Entries = append(m.Entries, entry)
+		for _, cat := range categorize(entry.Category) {
+			m.Categories[cat] = append(m.Categories[cat], entry.DesktopID)
+		}
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return strings.ToLower(m.Entries[i].NameLoc) < strings.ToLower(m.Entries[j].NameLoc)
+	})
+	summary := fmt.Sprintf("%v entries (+%v hidden)", len(m.Entries)-hidden, hidden)
+	log.Infof("Skipped %v duplicates; %v .desktop entries hidden by \"NoDisplay=true\"", skipped, hidden)
+	return summary
+}
+
+// categorize returns our categories for the Categories key value. freedesktop Main Categories list consists
+// of 13 entries. Let's contract it to 8+1 ("Other").
+func categorize(categories string) []string {
+	var result []string
+	add := func(name string) {
+		if !isIn(result, name) {
+			result = append(result, name)
+		}
+	}
+	for _, cat := range strings.Split(categories, ";") {
+		switch cat {
+		case "Utility":
+			add("utility")
+		case "Development":
+			add("development")
+		case "Game":
+			add("game")
+		case "Graphics":
+			add("graphics")
+		case "Network":
+			add("internet-and-network")
+		case "Office", "Science", "Education":
+			add("office")
+		case "AudioVideo", "Audio", "Video":
+			add("audio-video")
+		case "Settings", "System", "DesktopSettings", "PackageManager":
+			add("system-tools")
+		}
+	}
+	if categories != "" && len(result) == 0 {
+		add("other")
+	}
+	return result
+}
+
+// HasVisibleApps tells if the category contains anything but NoDisplay entries
+func (m *appModel) HasVisibleApps(category string) bool {
+	for _, desktopID := range m.Categories[category] {
+		if !m.ByID[desktopID].NoDisplay {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *appModel) SetQuery(category, phrase string) {
+	m.query = appQuery{Category: category, Phrase: phrase}
+	m.notify()
+}
+
+func (m *appModel) Query() appQuery {
+	return m.query
+}
+
+// Matches tells if the entry should be displayed for the current query. While searching, we ignore the category.
+func (m *appModel) Matches(entry desktopEntry) bool {
+	if entry.NoDisplay {
+		return false
+	}
+	if m.query.Phrase != "" {
+		return rank(entry, m.query.Phrase) > 0
+	}
+	return m.query.Category == "" || isIn(m.Categories[m.query.Category], entry.DesktopID)
+}
+
+// Compare returns a negative number if a should be displayed before b, positive if after, 0 if it's the same app.
+// Better matches of the search phrase go first, then we sort by name.
+func (m *appModel) Compare(a, b desktopEntry) int {
+	if m.query.Phrase != "" {
+		if ra, rb := rank(a, m.query.Phrase), rank(b, m.query.Phrase); ra != rb {
+			return rb - ra
+		}
+	}
+	if c := strings.Compare(strings.ToLower(a.NameLoc), strings.ToLower(b.NameLoc)); c != 0 {
+		return c
+	}
+	return strings.Compare(a.DesktopID, b.DesktopID)
+}
+
+// Results returns entries matching the current query, best matches first
+func (m *appModel) Results() []desktopEntry {
+	var results []desktopEntry
+	for _, entry := range m.Entries {
+		if m.Matches(entry) {
+			results = append(results, entry)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return m.Compare(results[i], results[j]) < 0
+	})
+	return results
+}
+
+// rank tells how well the entry matches the phrase: 0 if not at all, the more the better
+func rank(entry desktopEntry, phrase string) int {
+	needle := strings.ToLower(strings.TrimSpace(phrase))
+	if needle == "" {
+		return 1
+	}
+	if r := rankName(strings.ToLower(entry.NameLoc), needle); r > 0 {
+		return r
+	}
+	switch {
+	case strings.Contains(strings.ToLower(entry.CommentLoc), needle) ||
+		strings.Contains(strings.ToLower(entry.Comment), needle):
+		return 2
+	case strings.Contains(strings.ToLower(entry.Exec), needle):
+		return 1
+	}
+	return 0
+}
+
+// rankName tells how well the lower case name matches the lower case needle: from 3 to 6, or 0 if not at all
+func rankName(name, needle string) int {
+	switch {
+	case name == needle:
+		return 6
+	case strings.HasPrefix(name, needle):
+		return 5
+	case strings.Contains(" "+name, " "+needle):
+		// one of the following words starts with the phrase
+		return 4
+	case subsequenceMatch(needle, name):
+		return 3
+	}
+	return 0
+}
+
+func subsequenceMatch(needle, haystack string) bool {
+	needle = strings.ToLower(strings.TrimSpace(needle))
+	haystack = strings.ToLower(haystack)
+
+	n, h := 0, 0
+	for n < len(needle) && h < len(haystack) {
+		if needle[n] == haystack[h] {
+			n++
+		}
+		h++
+	}
+	return n == len(needle)
+}
+
+// pinStore holds desktop IDs of pinned items, persisted in a text file, one ID per line
+type pinStore struct {
+	Items []string
+	path  string
+	// items known returns false for are not saved, e.g. uninstalled apps; nil to save all
+	known     func(id string) bool
+	observers []func()
+}
+
+var pins *pinStore
+
+func newPinStore(path string, known func(id string) bool) *pinStore {
+	return &pinStore{path: path, known: known}
+}
+
+// Observe registers a function to be called whenever the pinned items change
+func (p *pinStore) Observe(f func()) {
+	p.observers = append(p.observers, f)
+}
+
+func (p *pinStore) notify() {
+	for _, f := range p.observers {
+		f()
+	}
+}
+
+// Load reads the file. Observers are notified if the content changed.
+func (p *pinStore) Load() error {
+	items, err := loadTextFile(p.path)
+	if err != nil {
+		return err
+	}
+	if strings.Join(items, "\n") != strings.Join(p.Items, "\n") {
+		p.Items = items
+		p.notify()
+	}
+	return nil
+}
+
+func (p *pinStore) Save() error {
+	var lines []string
+	for _, id := range p.Items {
+		//skip invalid lines
+		if id != "" && (p.known == nil || p.known(id)) {
+			lines = append(lines, id+"\n")
+		}
+	}
+	return os.WriteFile(p.path, []byte(strings.Join(lines, "")), 0644)
+}
+
+func (p *pinStore) Contains(id string) bool {
+	return isIn(p.Items, id)
+}
+
+// Pin adds the item at the end, saves the file, and returns false if it's been pinned already
+func (p *pinStore) Pin(id string) bool {
+	if p.Contains(id) {
+		log.Warnf("%s already pinned", id)
+		return false
+	}
+	p.Items = append(p.Items, id)
+	p.saveAndNotify()
+	log.Infof("%s pinned", id)
+	return true
+}
+
+// Unpin removes the item, saves the file, and returns false if it's not been pinned
+func (p *pinStore) Unpin(id string) bool {
+	if !p.Contains(id) {
+		return false
+	}
+	p.Items = remove(p.Items, id)
+	p.saveAndNotify()
+	log.Infof("%s unpinned", id)
+	return true
+}
+
+func (p *pinStore) saveAndNotify() {
+	if err := p.Save(); err != nil {
+		log.Errorf("Error saving pinned: %s", err)
+	}
+	p.notify()
+}
+
+// launchRequest describes a command to run
+type launchRequest struct {
+	// field codes expanded or trimmed already, so a % is a part of the command, e.g. of a file name
+	Command  string
+	Terminal bool
+	// the terminal emulator window title and app_id (class), if Terminal
+	Title string
+	AppID string
+	// additional environment variables in the KEY=value form
+	Env []string
+}
+
+// entryLaunchRequest returns the request to run the command on behalf of the entry. For terminal apps, we ask
+// the terminal emulator to use the app name as the window title, and its desktop ID as the app_id / class.
+func entryLaunchRequest(entry desktopEntry, command, token string) launchRequest {
+	req := launchRequest{Command: command, Terminal: entry.Terminal}
+	if entry.Terminal {
+		req.Title = entry.NameLoc
+		req.AppID = strings.TrimSuffix(entry.DesktopID, ".desktop")
+	}
+	if token != "" {
+		req.Env = []string{"XDG_ACTIVATION_TOKEN=" + token, "DESKTOP_STARTUP_ID=" + token}
+	}
+	return req
+}
+
+// trimFieldCodes drops the first field code of the Exec line, and everything after it
+func trimFieldCodes(command string) string {
+	if cutAt := strings.Index(command, "%"); cutAt != -1 {
+		return strings.TrimRight(command[:cutAt], " ")
+	}
+	return command
+}
+
+// expandFileFieldCodes substitutes the %f, %F, %u and %U field codes of the Exec line with the file path,
+// and drops the remaining ones. If the Exec line takes no file argument, the path is appended.
+func expandFileFieldCodes(command, filePath string) string {
+	quoted := "'" + strings.ReplaceAll(filePath, "'", `'\''`) + "'"
+	var fields []string
+	found := false
+	for _, field := range strings.Fields(command) {
+		switch field {
+		case "%f", "%F", "%u", "%U":
+			if !found {
+				fields = append(fields, quoted)
+				found = true
+			}
+		default:
+			if !strings.HasPrefix(field, "%") {
+				fields = append(fields, field)
+			}
+		}
+	}
+	if !found {
+		fields = append(fields, quoted)
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testModel() *appModel {
+	m := newAppModel()
+	m.SetEntries(map[string]desktopEntry{
+		"/usr/share/applications/firefox.desktop": {DesktopID: "firefox.desktop", NameLoc: "Firefox",
+			CommentLoc: "Browse the Web", Exec: "firefox %u", Category: "Network;WebBrowser;"},
+		"/usr/share/applications/gimp.desktop": {DesktopID: "gimp.desktop", NameLoc: "GNU Image Manipulation Program",
+			Exec: "gimp-2.10 %U", Category: "Graphics;2DGraphics;"},
+		"/usr/share/applications/foot.desktop": {DesktopID: "foot.desktop", NameLoc: "Foot",
+			Exec: "foot", Category: "System;TerminalEmulator;"},
+		"/usr/share/applications/fi.desktop": {DesktopID: "fi.desktop", NameLoc: "Fi", Exec: "fi", Category: "Misc;"},
+		"/usr/share/applications/hidden.desktop": {DesktopID: "hidden.desktop", NameLoc: "Hidden",
+			Category: "Game;", NoDisplay: true},
+		// shadowed by the user's own copy
+		"/home/user/.local/share/applications/foot.desktop": {DesktopID: "foot.desktop", NameLoc: "Foot (mine)",
+			Exec: "foot -e htop", Category: "System;"},
+	}, []string{"/home/user/.local/share/applications", "/usr/share/applications"})
+	return m
+}
+
+func resultIDs(m *appModel) []string {
+	var ids []string
+	for _, entry := range m.Results() {
+		ids = append(ids, entry.DesktopID)
+	}
+	return ids
+}
+
+func TestSetEntries(t *testing.T) {
+	m := testModel()
+	if len(m.Entries) != 5 {
+		t.Errorf("expected 5 entries, got %v", len(m.Entries))
+	}
+	if m.ByID["foot.desktop"].NameLoc != "Foot (mine)" {
+		t.Errorf("entry from the first dir should win, got %q", m.ByID["foot.desktop"].NameLoc)
+	}
+	if !reflect.DeepEqual(m.Categories["other"], []string{"fi.desktop"}) {
+		t.Errorf("unexpected other category: %v", m.Categories["other"])
+	}
+	if m.HasVisibleApps("game") {
+		t.Error("category with NoDisplay entries only should not show up")
+	}
+	if !m.HasVisibleApps("system-tools") {
+		t.Error("system-tools category should show up")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	m := testModel()
+	notified := 0
+	m.Observe(func() { notified++ })
+
+	m.SetQuery("", "")
+	if got := resultIDs(m); !reflect.DeepEqual(got, []string{"fi.desktop", "firefox.desktop", "foot.desktop", "gimp.desktop"}) {
+		t.Errorf("all visible apps by name expected, got %v", got)
+	}
+
+	m.SetQuery("graphics", "")
+	if got := resultIDs(m); !reflect.DeepEqual(got, []string{"gimp.desktop"}) {
+		t.Errorf("graphics category: got %v", got)
+	}
+
+	// the category is ignored while searching
+	m.SetQuery("graphics", "fi")
+	if got := resultIDs(m); !reflect.DeepEqual(got, []string{"fi.desktop", "firefox.desktop", "foot.desktop"}) {
+		t.Errorf("exact match, prefix match, then subsequence match expected, got %v", got)
+	}
+
+	m.SetQuery("", "web")
+	if got := resultIDs(m); !reflect.DeepEqual(got, []string{"firefox.desktop"}) {
+		t.Errorf("comment match expected, got %v", got)
+	}
+
+	m.SetQuery("", "image")
+	if got := resultIDs(m); !reflect.DeepEqual(got, []string{"gimp.desktop"}) {
+		t.Errorf("word prefix match expected, got %v", got)
+	}
+
+	m.SetQuery("", "hidden")
+	if got := resultIDs(m); got != nil {
+		t.Errorf("NoDisplay entries should never match, got %v", got)
+	}
+
+	if notified != 6 {
+		t.Errorf("expected 6 notifications, got %v", notified)
+	}
+}
+
+func TestRank(t *testing.T) {
+	entry := desktopEntry{NameLoc: "GNU Image Manipulation Program", CommentLoc: "Edit pictures", Exec: "gimp-2.10"}
+	for phrase, expected := range map[string]int{
+		"gnu image manipulation program": 6,
+		"GNU":                            5,
+		"manip":                          4,
+		"gimp":                           3,
+		"pictures":                       2,
+		"2.10":                           1,
+		"xyz":                            0,
+	} {
+		if r := rank(entry, phrase); r != expected {
+			t.Errorf("rank for %q: expected %v, got %v", phrase, expected, r)
+		}
+	}
+}
+
+func TestPinStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pinned")
+	if err := os.WriteFile(path, []byte("firefox.desktop\nuninstalled.desktop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	known := func(id string) bool { return id != "uninstalled.desktop" }
+
+	p := newPinStore(path, known)
+	notified := 0
+	p.Observe(func() { notified++ })
+
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if notified != 1 || !p.Contains("firefox.desktop") {
+		t.Fatalf("pinned items not loaded: %v", p.Items)
+	}
+	if err := p.Load(); err != nil || notified != 1 {
+		t.Errorf("observers should not be notified if nothing changed")
+	}
+
+	if !p.Pin("foot.desktop") || p.Pin("foot.desktop") {
+		t.Error("an item should only get pinned once")
+	}
+	if !p.Unpin("firefox.desktop") || p.Unpin("firefox.desktop") {
+		t.Error("an item should only get unpinned once")
+	}
+
+	saved := newPinStore(path, known)
+	if err := saved.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Items, []string{"foot.desktop"}) {
+		t.Errorf("unexpected saved items: %v", saved.Items)
+	}
+}
+
+func TestEntryLaunchRequest(t *testing.T) {
+	entry := desktopEntry{DesktopID: "htop.desktop", NameLoc: "Htop", Terminal: true}
+	req := entryLaunchRequest(entry, "htop", "token")
+	expected := launchRequest{Command: "htop", Terminal: true, Title: "Htop", AppID: "htop",
+		Env: []string{"XDG_ACTIVATION_TOKEN=token", "DESKTOP_STARTUP_ID=token"}}
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("expected %+v, got %+v", expected, req)
+	}
+
+	req = entryLaunchRequest(desktopEntry{DesktopID: "firefox.desktop", NameLoc: "Firefox"}, "firefox", "")
+	if !reflect.DeepEqual(req, launchRequest{Command: "firefox"}) {
+		t.Errorf("unexpected request: %+v", req)
+	}
+}
+
+func TestExpandFileFieldCodes(t *testing.T) {
+	for _, c := range []struct{ command, path, expected string }{
+		{"gimp %U", "/tmp/a.png", "gimp '/tmp/a.png'"},
+		{"vlc --started-from-file %U %i", "/tmp/it's.mp4", `vlc --started-from-file '/tmp/it'\''s.mp4'`},
+		{"mousepad", "/tmp/a.txt", "mousepad '/tmp/a.txt'"},
+		{"papers %U", "/home/u/50% off.pdf", "papers '/home/u/50% off.pdf'"},
+	} {
+		if got := expandFileFieldCodes(c.command, c.path); got != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, got)
+		}
+	}
+}
+
+func TestTrimFieldCodes(t *testing.T) {
+	for command, expected := range map[string]string{
+		"firefox %u":               "firefox",
+		"gimp-2.10 %U --no-splash": "gimp-2.10",
+		"htop":                     "htop",
+		"%f":                       "",
+	} {
+		if got := trimFieldCodes(command); got != expected {
+			t.Errorf("%s: expected %q, got %q", command, expected, got)
+		}
+	}
+}
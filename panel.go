@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/diamondburned/gotk4-layer-shell/pkg/gtklayershell"
+	log "github.com/sirupsen/logrus"
+)
+
+// In the panel mode the window is not stretched over the whole output, but anchored to a corner or an edge, like
+// a start menu. The -panel argument is a position, e.g. "bottom-left"; "left" means the left edge, and "center"
+// means no anchors at all. The window is -pw wide and -ph tall, unless stretched along the edge it's anchored to.
+
+var panelPositions = []string{"top-left", "top", "top-right", "left", "center", "right", "bottom-left", "bottom",
+	"bottom-right"}
+
+func validatePanel() {
+	if *panel != "" && !isIn(panelPositions, *panel) {
+		log.Warnf("-panel argument can be only one of: %s; using the full screen mode",
+			strings.Join(panelPositions, ", "))
+		*panel = ""
+	}
+}
+
+func panelMode() bool {
+	return *panel != ""
+}
+
+// panelEdges returns the edges a window in the given position should be anchored to
+func panelEdges(position string) map[gtklayershell.Edge]bool {
+	edges := map[gtklayershell.Edge]bool{}
+	switch position {
+	case "top-left":
+		edges[gtklayershell.LayerShellEdgeTop] = true
+		edges[gtklayershell.LayerShellEdgeLeft] = true
+	case "top-right":
+		edges[gtklayershell.LayerShellEdgeTop] = true
+		edges[gtklayershell.LayerShellEdgeRight] = true
+	case "bottom-left":
+		edges[gtklayershell.LayerShellEdgeBottom] = true
+		edges[gtklayershell.LayerShellEdgeLeft] = true
+	case "bottom-right":
+		edges[gtklayershell.LayerShellEdgeBottom] = true
+		edges[gtklayershell.LayerShellEdgeRight] = true
+	case "top", "bottom":
+		// stretched along the edge
+		edges[gtklayershell.LayerShellEdgeLeft] = true
+		edges[gtklayershell.LayerShellEdgeRight] = true
+		if position == "top" {
+			edges[gtklayershell.LayerShellEdgeTop] = true
+		} else {
+			edges[gtklayershell.LayerShellEdgeBottom] = true
+		}
+	case "left", "right":
+		edges[gtklayershell.LayerShellEdgeTop] = true
+		edges[gtklayershell.LayerShellEdgeBottom] = true
+		if position == "left" {
+			edges[gtklayershell.LayerShellEdgeLeft] = true
+		} else {
+			edges[gtklayershell.LayerShellEdgeRight] = true
+		}
+	case "center":
+	default:
+		// full screen
+		edges[gtklayershell.LayerShellEdgeTop] = true
+		edges[gtklayershell.LayerShellEdgeBottom] = true
+		edges[gtklayershell.LayerShellEdgeLeft] = true
+		edges[gtklayershell.LayerShellEdgeRight] = true
+	}
+	return edges
+}
+
+// anchorWindow anchors the layer surface to the screen edges, and sets the size of the panel
+func anchorWindow() {
+	edges := panelEdges(*panel)
+	for _, edge := range []gtklayershell.Edge{gtklayershell.LayerShellEdgeTop,
+		gtklayershell.LayerShellEdgeBottom, gtklayershell.LayerShellEdgeLeft, gtklayershell.LayerShellEdgeRight} {
+		gtklayershell.SetAnchor(win, edge, edges[edge])
+	}
+
+	if panelMode() {
+		log.Infof("Panel mode: %s, %vx%v", *panel, *panelWidth, *panelHeight)
+		win.SetSizeRequest(*panelWidth, *panelHeight)
+	}
+}
+
+// panelColumns returns the number of app grid columns, that fit the panel width, unless given with -c
+func panelColumns() uint {
+	if !panelMode() || isFlagPassed("c") {
+		return *columnsNumber
+	}
+	// 20px of window padding on both sides, and some room for the button padding & the label
+	cell := *iconSize + int(*itemSpacing) + 24
+	columns := (*panelWidth - 40) / cell
+	if columns < 1 {
+		columns = 1
+	}
+	return uint(columns)
+}
+
+func isFlagPassed(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
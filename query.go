@@ -0,0 +1,349 @@
+package main
+
+import (
+	"container/heap"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// File search phrases may contain operators besides the text to look for, e.g.
+// `report ext:pdf,odt in:documents modified:<7d size:>1M type:file sort:recent "annual report"`.
+// Unknown operators, and operators with values we can't parse, are searched for as text.
+
+type fileQuery struct {
+	Terms     []string      // lower case words, all of which need to match
+	Phrases   []string      // lower case quoted phrases, matched as they are, spaces included
+	Exts      []string      // lower case extensions without the dot, any of which needs to match
+	Type      string        // "dir" or "file", "" for both
+	In        []string      // lower case search dir names, any of which needs to match
+	NewerThan time.Duration // modified:<7d
+	OlderThan time.Duration // modified:>7d
+	Larger    int64         // size:>10M
+	Smaller   int64         // size:<100k
+	Recent    bool          // sort by modification time, newest first, instead of relevance
+}
+
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// splitQuery splits the phrase on whitespace, but keeps quoted phrases together. An unclosed quote takes
+// the rest of the phrase.
+func splitQuery(phrase string) []queryToken {
+	var tokens []queryToken
+	var current strings.Builder
+	quoted := false
+	flush := func(wasQuoted bool) {
+		if current.Len() > 0 || wasQuoted {
+			tokens = append(tokens, queryToken{current.String(), wasQuoted})
+		}
+		current.Reset()
+	}
+	for _, r := range phrase {
+		switch {
+		case r == '"':
+			flush(quoted)
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush(false)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush(quoted)
+	return tokens
+}
+
+func parseFileQuery(phrase string) fileQuery {
+	var q fileQuery
+	sortGiven := false
+	for _, token := range splitQuery(phrase) {
+		text := strings.ToLower(token.text)
+		if token.quoted {
+			if strings.TrimSpace(text) != "" {
+				q.Phrases = append(q.Phrases, text)
+			}
+			continue
+		}
+		if key, value, found := strings.Cut(text, ":"); found && q.applyOperator(key, value) {
+			sortGiven = sortGiven || key == "sort"
+			continue
+		}
+		q.Terms = append(q.Terms, text)
+	}
+	// with nothing to rank by, let's show what's been modified recently
+	if !sortGiven && len(q.Terms) == 0 && len(q.Phrases) == 0 {
+		q.Recent = true
+	}
+	return q
+}
+
+// applyOperator sets the query up for the key:value operator, and returns false if it's not one we know
+func (q *fileQuery) applyOperator(key, value string) bool {
+	if value == "" {
+		return false
+	}
+	switch key {
+	case "ext":
+		for _, ext := range strings.Split(value, ",") {
+			if ext = strings.TrimPrefix(ext, "."); ext != "" {
+				q.Exts = append(q.Exts, ext)
+			}
+		}
+	case "type":
+		switch value {
+		case "dir", "d", "folder":
+			q.Type = "dir"
+		case "file", "f":
+			q.Type = "file"
+		default:
+			return false
+		}
+	case "in":
+		q.In = append(q.In, strings.Split(value, ",")...)
+	case "modified":
+		age, ok := parseAge(value[1:])
+		if !ok {
+			return false
+		}
+		switch value[0] {
+		case '<':
+			q.NewerThan = age
+		case '>':
+			q.OlderThan = age
+		default:
+			return false
+		}
+	case "size":
+		size, ok := parseSize(value[1:])
+		if !ok {
+			return false
+		}
+		switch value[0] {
+		case '>':
+			q.Larger = size
+		case '<':
+			q.Smaller = size
+		default:
+			return false
+		}
+	case "sort":
+		switch value {
+		case "recent":
+			q.Recent = true
+		case "relevance":
+			q.Recent = false
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+var ageUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'm': 30 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// parseAge parses e.g. "12h", "7d", "2w", "3m" or "1y"
+func parseAge(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	unit, ok := ageUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value[:len(value)-1], 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n * float64(unit)), true
+}
+
+var sizeUnits = map[string]int64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+
+// parseSize parses e.g. "500", "100k", "1.5M" or "2GB"
+func parseSize(value string) (int64, bool) {
+	value = strings.TrimSuffix(strings.ToLower(value), "b")
+	number := strings.TrimRightFunc(value, unicode.IsLetter)
+	unit, ok := sizeUnits[value[len(number):]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return int64(n * float64(unit)), true
+}
+
+// searches tells if the search dir of the name is to be searched
+func (q fileQuery) searches(name string) bool {
+	return len(q.In) == 0 || isIn(q.In, strings.ToLower(name))
+}
+
+// rank tells how well the path relative to the search dir matches the query, 0 if not at all. Modification time
+// and size are checked separately, not to get them for files that don't match anyway.
+func (q fileQuery) rank(rel string, isDir bool) int {
+	if q.Type == "dir" && !isDir || q.Type == "file" && isDir {
+		return 0
+	}
+	lower := strings.ToLower(rel)
+	if len(q.Exts) > 0 && !isIn(q.Exts, strings.TrimPrefix(filepath.Ext(lower), ".")) {
+		return 0
+	}
+	for _, phrase := range q.Phrases {
+		if !strings.Contains(lower, phrase) {
+			return 0
+		}
+	}
+
+	if len(q.Terms) == 0 {
+		if len(q.Phrases) > 0 {
+			return 2
+		}
+		return 1
+	}
+	if r := rankPath(rel, strings.Join(q.Terms, " ")); r > 0 {
+		return r
+	}
+	// all the words, but not next to each other
+	if len(q.Terms) > 1 {
+		for _, term := range q.Terms {
+			if !strings.Contains(lower, term) {
+				return 0
+			}
+		}
+		return 1
+	}
+	return 0
+}
+
+// rankPath tells how well the path relative to the search dir matches the lower case needle. The file name is
+// matched as the app name is, the rest of the path as the app comment.
+func rankPath(rel, needle string) int {
+	lower := strings.ToLower(rel)
+	if r := rankName(filepath.Base(lower), needle); r > 0 {
+		return r
+	}
+	if strings.Contains(lower, needle) {
+		return 2
+	}
+	return 0
+}
+
+// accepts tells if the file of the modification time and size passes the query filters
+func (q fileQuery) accepts(modTime time.Time, size int64, isDir bool, now time.Time) bool {
+	if q.NewerThan > 0 && now.Sub(modTime) > q.NewerThan {
+		return false
+	}
+	if q.OlderThan > 0 && now.Sub(modTime) < q.OlderThan {
+		return false
+	}
+	if (q.Larger > 0 || q.Smaller > 0) && isDir {
+		return false
+	}
+	if q.Larger > 0 && size <= q.Larger {
+		return false
+	}
+	if q.Smaller > 0 && size >= q.Smaller {
+		return false
+	}
+	return true
+}
+
+// less tells if a should be displayed before b
+func (q fileQuery) less(a, b fileMatch) bool {
+	if !q.Recent && a.Rank != b.Rank {
+		return a.Rank > b.Rank
+	}
+	if !a.ModTime.Equal(b.ModTime) {
+		return a.ModTime.After(b.ModTime)
+	}
+	return a.Path < b.Path
+}
+
+// topFileMatches returns the limit of best matches, grouped by the search dir. Dirs go in the order of their
+// best match.
+func topFileMatches(matches []fileMatch, q fileQuery, limit int) []fileMatch {
+	top := append([]fileMatch{}, matches...)
+	sort.Slice(top, func(i, j int) bool {
+		return q.less(top[i], top[j])
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	dirOrder := make(map[string]int)
+	for _, m := range top {
+		if _, ok := dirOrder[m.Dir]; !ok {
+			dirOrder[m.Dir] = len(dirOrder)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return dirOrder[top[i].Dir] < dirOrder[top[j].Dir]
+	})
+	return top
+}
+
+// fileTop keeps the best matches offered so far, up to the limit, so that batches arriving during a search don't
+// make us sort all the matches again
+type fileTop struct {
+	heap  matchHeap
+	limit int
+	seen  int // how many matches were offered
+}
+
+func newFileTop(q fileQuery, limit int) *fileTop {
+	return &fileTop{heap: matchHeap{query: q}, limit: limit}
+}
+
+func (t *fileTop) add(matches ...fileMatch) {
+	for _, m := range matches {
+		t.seen++
+		if len(t.heap.items) < t.limit {
+			heap.Push(&t.heap, m)
+		} else if len(t.heap.items) > 0 && t.heap.query.less(m, t.heap.items[0]) {
+			t.heap.items[0] = m
+			heap.Fix(&t.heap, 0)
+		}
+	}
+}
+
+// best returns the kept matches, as topFileMatches does
+func (t *fileTop) best() []fileMatch {
+	return topFileMatches(t.heap.items, t.heap.query, t.limit)
+}
+
+// more tells if some matches didn't make it to the top
+func (t *fileTop) more() bool {
+	return t.seen > len(t.heap.items)
+}
+
+// matchHeap has the worst match on top
+type matchHeap struct {
+	query fileQuery
+	items []fileMatch
+}
+
+func (h matchHeap) Len() int            { return len(h.items) }
+func (h matchHeap) Less(i, j int) bool  { return h.query.less(h.items[j], h.items[i]) }
+func (h matchHeap) Swap(i, j int)       { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *matchHeap) Push(x interface{}) { h.items = append(h.items, x.(fileMatch)) }
+
+func (h *matchHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFileQuery(t *testing.T) {
+	for phrase, expected := range map[string]fileQuery{
+		"Annual Report":        {Terms: []string{"annual", "report"}},
+		`"annual report" 2024`: {Terms: []string{"2024"}, Phrases: []string{"annual report"}},
+		"ext:.PDF,odt in:documents,downloads type:file": {Exts: []string{"pdf", "odt"},
+			In: []string{"documents", "downloads"}, Type: "file", Recent: true},
+		"modified:<7d size:>1.5M":  {NewerThan: 7 * 24 * time.Hour, Larger: 3 << 19, Recent: true},
+		"modified:>1y size:<100kb": {OlderThan: 365 * 24 * time.Hour, Smaller: 100 << 10, Recent: true},
+		"type:dir sort:relevance":  {Type: "dir"},
+		"notes sort:recent":        {Terms: []string{"notes"}, Recent: true},
+		// not the operators we know, or values we can't parse
+		"http://x size:huge type:link": {Terms: []string{"http://x", "size:huge", "type:link"}},
+		`"unclosed quote`:              {Phrases: []string{"unclosed quote"}},
+	} {
+		if got := parseFileQuery(phrase); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %+v, got %+v", phrase, expected, got)
+		}
+	}
+}
+
+func TestFileQueryRank(t *testing.T) {
+	for _, c := range []struct {
+		phrase string
+		rel    string
+		isDir  bool
+		rank   int
+	}{
+		{"report", "report", false, 6},
+		{"report", "work/report.odt", false, 5},
+		{"report", "reports/2024.odt", false, 2},
+		{"annual report", "2024 annual report.odt", false, 4},
+		{"report 2024", "reports/2024.odt", false, 1},
+		{"report 2025", "reports/2024.odt", false, 0},
+		{`"annual report"`, "old/annual report.odt", false, 2},
+		{`"annual report"`, "old/report annual.odt", false, 0},
+		{"report ext:odt", "report.pdf", false, 0},
+		{"report type:dir", "report", false, 0},
+		{"type:dir", "reports", true, 1},
+	} {
+		if got := parseFileQuery(c.phrase).rank(c.rel, c.isDir); got != c.rank {
+			t.Errorf("%s in %s: expected %d, got %d", c.phrase, c.rel, c.rank, got)
+		}
+	}
+}
+
+func TestFileQueryAccepts(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		phrase  string
+		age     time.Duration
+		size    int64
+		isDir   bool
+		accepts bool
+	}{
+		{"modified:<7d", 24 * time.Hour, 0, false, true},
+		{"modified:<7d", 8 * 24 * time.Hour, 0, false, false},
+		{"modified:>12h", 24 * time.Hour, 0, false, true},
+		{"modified:>12h", time.Hour, 0, false, false},
+		{"size:>1k", 0, 2048, false, true},
+		{"size:>1k", 0, 1024, false, false},
+		{"size:>1k", 0, 2048, true, false},
+		{"size:<1M", 0, 1024, false, true},
+	} {
+		if got := parseFileQuery(c.phrase).accepts(now.Add(-c.age), c.size, c.isDir, now); got != c.accepts {
+			t.Errorf("%s (age %v, size %d): expected %v", c.phrase, c.age, c.size, c.accepts)
+		}
+	}
+}
+
+func TestTopFileMatches(t *testing.T) {
+	now := time.Now()
+	matches := []fileMatch{
+		{Dir: "documents", Path: "/d/old.odt", Rank: 5, ModTime: now.Add(-time.Hour)},
+		{Dir: "pictures", Path: "/p/best.png", Rank: 6, ModTime: now.Add(-2 * time.Hour)},
+		{Dir: "documents", Path: "/d/new.odt", Rank: 2, ModTime: now},
+		{Dir: "pictures", Path: "/p/worst.png", Rank: 1, ModTime: now.Add(-3 * time.Hour)},
+	}
+	paths := func(matches []fileMatch) []string {
+		var result []string
+		for _, m := range matches {
+			result = append(result, m.Path)
+		}
+		return result
+	}
+
+	// dirs go in the order of their best match
+	expected := []string{"/p/best.png", "/d/old.odt", "/d/new.odt"}
+	if got := paths(topFileMatches(matches, fileQuery{}, 3)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("by relevance: expected %v, got %v", expected, got)
+	}
+	expected = []string{"/d/new.odt", "/d/old.odt", "/p/best.png", "/p/worst.png"}
+	if got := paths(topFileMatches(matches, fileQuery{Recent: true}, 10)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("by recency: expected %v, got %v", expected, got)
+	}
+}
+
+func TestFileTop(t *testing.T) {
+	now := time.Now()
+	var matches []fileMatch
+	for i := 0; i < 50; i++ {
+		matches = append(matches, fileMatch{Dir: []string{"documents", "pictures", "music"}[i%3],
+			Path: fmt.Sprintf("/f/%02d", i), Rank: (i * 7) % 5, ModTime: now.Add(-time.Duration(i*13%11) * time.Hour)})
+	}
+
+	for _, q := range []fileQuery{{}, {Recent: true}} {
+		for _, limit := range []int{1, 10, 50, 60} {
+			top := newFileTop(q, limit)
+			// in batches, as they arrive during a search
+			for i := 0; i < len(matches); i += 20 {
+				top.add(matches[i:min(i+20, len(matches))]...)
+			}
+			expected := topFileMatches(matches, q, limit)
+			if got := top.best(); !reflect.DeepEqual(got, expected) {
+				t.Errorf("recent %v, limit %v: expected %v, got %v", q.Recent, limit, expected, got)
+			}
+			if top.more() != (limit < len(matches)) {
+				t.Errorf("recent %v, limit %v: expected more == %v", q.Recent, limit, limit < len(matches))
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Recently used files come from the recently-used.xbel file, written by GTK (and Qt) apps whenever they open
+// a file. They're displayed while the search box is empty, on the "recent:" prefix, and in file search results.
+
+// recentFile is a file some app has opened recently
+type recentFile struct {
+	Path    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	Visited time.Time // when it was last opened, by any app
+	App     recentApp // the app that opened it last
+}
+
+// recentApp is an app registered in the bookmark, e.g. {"Document Viewer", "'papers %u'"}
+type recentApp struct {
+	Name     string
+	Exec     string
+	Modified time.Time
+}
+
+// These are parts of the XBEL file we need; namespaces don't matter, as we match local names
+type xbel struct {
+	Bookmarks []xbelBookmark `xml:"bookmark"`
+}
+
+type xbelBookmark struct {
+	Href         string            `xml:"href,attr"`
+	Modified     string            `xml:"modified,attr"`
+	Visited      string            `xml:"visited,attr"`
+	Applications []xbelApplication `xml:"info>metadata>applications>application"`
+}
+
+type xbelApplication struct {
+	Name     string `xml:"name,attr"`
+	Exec     string `xml:"exec,attr"`
+	Modified string `xml:"modified,attr"`
+}
+
+// recentFilesPath returns the path to the recently-used.xbel file
+func recentFilesPath() string {
+	if xdgData := os.Getenv("XDG_DATA_HOME"); xdgData != "" {
+		return filepath.Join(xdgData, "recently-used.xbel")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local/share/recently-used.xbel")
+}
+
+// loadRecentFiles parses the XBEL file, and returns local files that still exist, most recently opened first
+func loadRecentFiles(path string) ([]recentFile, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc xbel
+	if err := xml.Unmarshal(bytes, &doc); err != nil {
+		return nil, err
+	}
+
+	var files []recentFile
+	for _, b := range doc.Bookmarks {
+		u, err := url.Parse(b.Href)
+		if err != nil || u.Scheme != "file" || u.Path == "" {
+			continue
+		}
+		info, err := os.Stat(u.Path)
+		if err != nil {
+			continue
+		}
+		file := recentFile{Path: u.Path, IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime(),
+			Visited: parseXbelTime(b.Visited)}
+		if modified := parseXbelTime(b.Modified); modified.After(file.Visited) {
+			file.Visited = modified
+		}
+		for _, a := range b.Applications {
+			app := recentApp{Name: a.Name, Exec: strings.Trim(a.Exec, "'"), Modified: parseXbelTime(a.Modified)}
+			if file.App.Name == "" || app.Modified.After(file.App.Modified) {
+				file.App = app
+			}
+		}
+		if file.App.Modified.After(file.Visited) {
+			file.Visited = file.App.Modified
+		}
+		files = append(files, file)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Visited.After(files[j].Visited)
+	})
+	return files, nil
+}
+
+// parseXbelTime parses ISO 8601 timestamps, as "2024-05-01T10:00:00.123456Z"; zero time if not parseable
+func parseXbelTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+// appEntry returns the desktop entry of the app, found by the desktop ID, the name, or the command
+func (a recentApp) appEntry(m *appModel) (desktopEntry, bool) {
+	if a.Name == "" {
+		return desktopEntry{}, false
+	}
+	if entry, ok := m.ByID[a.Name+".desktop"]; ok {
+		return entry, true
+	}
+	for _, entry := range m.Entries {
+		if strings.EqualFold(entry.Name, a.Name) {
+			return entry, true
+		}
+	}
+	command := execBase(a.Exec)
+	if command == "" {
+		return desktopEntry{}, false
+	}
+	for _, entry := range m.Entries {
+		if !entry.NoDisplay && execBase(entry.Exec) == command {
+			return entry, true
+		}
+	}
+	return desktopEntry{}, false
+}
+
+// execBase returns the base name of the command of the Exec line, e.g. "papers" for "/usr/bin/papers %U"
+func execBase(exec string) string {
+	fields := strings.Fields(exec)
+	if len(fields) == 0 {
+		return ""
+	}
+	return filepath.Base(strings.Trim(fields[0], `'"`))
+}
+
+// recentDirName is the pseudo search dir of recent files in file search results
+const recentDirName = "recent"
+
+var recentDir = searchRoot{Icon: "document-open-recent", Name: "Recent"}
+
+var (
+	recentFiles       []recentFile
+	recentFilesByPath map[string]recentFile
+	recentFilesLoaded time.Time // the modification time of the file, when last loaded
+)
+
+// currentRecentFiles returns recent files, reloaded if the XBEL file has changed since last time. Main loop only.
+func currentRecentFiles() []recentFile {
+	path := recentFilesPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		recentFiles, recentFilesByPath, recentFilesLoaded = nil, nil, time.Time{}
+		return nil
+	}
+	if info.ModTime().Equal(recentFilesLoaded) {
+		return recentFiles
+	}
+
+	files, err := loadRecentFiles(path)
+	if err != nil {
+		log.Warnf("Error loading recent files: %s", err)
+	}
+	recentFiles, recentFilesLoaded = files, info.ModTime()
+	recentFilesByPath = make(map[string]recentFile)
+	for _, f := range files {
+		recentFilesByPath[f.Path] = f
+	}
+	log.Debugf("Loaded %v recent files from %s", len(files), path)
+	return recentFiles
+}
+
+// recentMatches returns recent files matching the query. The file name is ranked, and the time it was last
+// opened counts as the modification time.
+func recentMatches(files []recentFile, q fileQuery, now time.Time) []fileMatch {
+	if !q.searches(recentDirName) {
+		return nil
+	}
+	var matches []fileMatch
+	for _, f := range files {
+		if r := q.rank(filepath.Base(f.Path), f.IsDir); r > 0 && q.accepts(f.Visited, f.Size, f.IsDir, now) {
+			matches = append(matches, fileMatch{Dir: recentDirName, Path: f.Path, IsDir: f.IsDir, Rank: r,
+				ModTime: f.Visited, Size: f.Size})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testXbel = `<?xml version="1.0" encoding="UTF-8"?>
+<xbel version="1.0"
+      xmlns:bookmark="http://www.freedesktop.org/standards/desktop-bookmarks"
+      xmlns:mime="http://www.freedesktop.org/standards/shared-mime-info"
+>
+  <bookmark href="file://%[1]s/report%%202024.pdf" added="2024-05-01T10:00:00.000001Z" modified="2024-05-01T10:00:00.000001Z" visited="2024-05-01T10:00:00.000001Z">
+    <info>
+      <metadata owner="http://freedesktop.org">
+        <mime:mime-type type="application/pdf"/>
+        <bookmark:applications>
+          <bookmark:application name="Document Viewer" exec="&apos;papers %%u&apos;" modified="2024-05-01T10:00:00.000001Z" count="1"/>
+          <bookmark:application name="org.gnome.TextEditor" exec="&apos;gnome-text-editor %%u&apos;" modified="2024-05-03T10:00:00.000001Z" count="2"/>
+        </bookmark:applications>
+      </metadata>
+    </info>
+  </bookmark>
+  <bookmark href="file://%[1]s/notes.txt" added="2024-05-02T10:00:00Z" modified="2024-05-02T10:00:00Z" visited="2024-05-02T10:00:00Z">
+    <info>
+      <metadata owner="http://freedesktop.org">
+        <bookmark:applications>
+          <bookmark:application name="Unknown Editor" exec="&apos;/opt/editor/bin/edit %%f&apos;" modified="2024-05-02T10:00:00Z" count="1"/>
+        </bookmark:applications>
+      </metadata>
+    </info>
+  </bookmark>
+  <bookmark href="file://%[1]s/deleted.txt" added="2024-05-04T10:00:00Z" modified="2024-05-04T10:00:00Z" visited="2024-05-04T10:00:00Z"/>
+  <bookmark href="https://example.com/remote.txt" added="2024-05-04T10:00:00Z" modified="2024-05-04T10:00:00Z" visited="2024-05-04T10:00:00Z"/>
+</xbel>
+`
+
+func writeRecentFiles(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"report 2024.pdf", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	xbelPath := filepath.Join(dir, "recently-used.xbel")
+	if err := os.WriteFile(xbelPath, []byte(fmt.Sprintf(testXbel, dir)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, xbelPath
+}
+
+func TestLoadRecentFiles(t *testing.T) {
+	dir, xbelPath := writeRecentFiles(t)
+	files, err := loadRecentFiles(xbelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := func(name string) time.Time {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+	// files that don't exist, and remote ones, are dropped; the most recently opened go first
+	expected := []recentFile{
+		{
+			Path:    filepath.Join(dir, "report 2024.pdf"),
+			Size:    7,
+			ModTime: modTime("report 2024.pdf"),
+			Visited: time.Date(2024, 5, 3, 10, 0, 0, 1000, time.UTC),
+			App: recentApp{Name: "org.gnome.TextEditor", Exec: "gnome-text-editor %u",
+				Modified: time.Date(2024, 5, 3, 10, 0, 0, 1000, time.UTC)},
+		},
+		{
+			Path:    filepath.Join(dir, "notes.txt"),
+			Size:    7,
+			ModTime: modTime("notes.txt"),
+			Visited: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+			App: recentApp{Name: "Unknown Editor", Exec: "/opt/editor/bin/edit %f",
+				Modified: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %+v, got %+v", expected, files)
+	}
+}
+
+func TestRecentAppEntry(t *testing.T) {
+	m := newAppModel()
+	m.SetEntries(map[string]desktopEntry{
+		"/a/org.gnome.TextEditor.desktop": {DesktopID: "org.gnome.TextEditor.desktop", Name: "Text Editor",
+			Exec: "gnome-text-editor %U"},
+		"/a/papers.desktop": {DesktopID: "papers.desktop", Name: "Document Viewer", Exec: "papers %U"},
+		"/a/mpv.desktop":    {DesktopID: "mpv.desktop", Name: "mpv Media Player", Exec: "/usr/bin/mpv -- %U"},
+	}, []string{"/a"})
+
+	for _, c := range []struct {
+		app recentApp
+		id  string
+	}{
+		{recentApp{Name: "org.gnome.TextEditor", Exec: "gnome-text-editor %u"}, "org.gnome.TextEditor.desktop"},
+		{recentApp{Name: "document viewer", Exec: "evince %u"}, "papers.desktop"},
+		{recentApp{Name: "MPV", Exec: "'mpv' %u"}, "mpv.desktop"},
+		{recentApp{Name: "Unknown Editor", Exec: "/opt/editor/bin/edit %f"}, ""},
+		{recentApp{}, ""},
+	} {
+		entry, _ := c.app.appEntry(m)
+		if entry.DesktopID != c.id {
+			t.Errorf("%+v: expected %q, got %q", c.app, c.id, entry.DesktopID)
+		}
+	}
+}
+
+func TestRecentMatches(t *testing.T) {
+	_, xbelPath := writeRecentFiles(t)
+	files, err := loadRecentFiles(xbelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 4, 10, 0, 0, 0, time.UTC)
+
+	for phrase, expected := range map[string][]string{
+		"":                 {"report 2024.pdf", "notes.txt"},
+		"report":           {"report 2024.pdf"},
+		"ext:txt":          {"notes.txt"},
+		"modified:<36h":    {"report 2024.pdf"},
+		"notes in:recent":  {"notes.txt"},
+		"notes in:desktop": nil,
+	} {
+		var got []string
+		for _, m := range recentMatches(files, parseFileQuery(phrase), now) {
+			if m.Dir != recentDirName {
+				t.Errorf("%s: unexpected dir %s", phrase, m.Dir)
+			}
+			got = append(got, filepath.Base(m.Path))
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected %v, got %v", phrase, expected, got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shlex"
+	log "github.com/sirupsen/logrus"
+)
+
+// terminalProfile describes how to run a program in a terminal emulator:
+// <terminal> [Args] [Title] [AppID] [Exec] <program> <arguments>
+// In Title and AppID, %s is replaced with the actual value. If the terminal doesn't support setting them, leave empty.
+type terminalProfile struct {
+	Args  []string `json:"args"`
+	Title []string `json:"title"`
+	AppID []string `json:"app-id"`
+	Exec  []string `json:"exec"`
+}
+
+// Known terminal emulators, by the executable name. May be overridden or extended in the terminals.json file.
+var builtInTerminalProfiles = map[string]terminalProfile{
+	"foot":              {Title: []string{"--title=%s"}, AppID: []string{"--app-id=%s"}},
+	"kitty":             {Title: []string{"--title", "%s"}, AppID: []string{"--class", "%s"}, Exec: []string{"--"}},
+	"alacritty":         {Title: []string{"--title", "%s"}, AppID: []string{"--class", "%s"}, Exec: []string{"-e"}},
+	"wezterm":           {Args: []string{"start"}, AppID: []string{"--class", "%s"}, Exec: []string{"--"}},
+	"ghostty":           {Title: []string{"--title=%s"}, AppID: []string{"--class=%s"}, Exec: []string{"-e"}},
+	"gnome-terminal":    {Title: []string{"--title", "%s"}, Exec: []string{"--"}},
+	"kgx":               {Title: []string{"--title", "%s"}, Exec: []string{"--"}},
+	"konsole":           {Exec: []string{"-e"}},
+	"xfce4-terminal":    {Title: []string{"--title", "%s"}, Exec: []string{"-x"}},
+	"terminator":        {Title: []string{"--title", "%s"}, AppID: []string{"--classname", "%s"}, Exec: []string{"-x"}},
+	"xterm":             {Title: []string{"-T", "%s"}, AppID: []string{"-class", "%s"}, Exec: []string{"-e"}},
+	"urxvt":             {Title: []string{"-title", "%s"}, AppID: []string{"-name", "%s"}, Exec: []string{"-e"}},
+	"st":                {Title: []string{"-t", "%s"}, AppID: []string{"-c", "%s"}, Exec: []string{"-e"}},
+	"xdg-terminal-exec": {Title: []string{"--title=%s"}, AppID: []string{"--app-id=%s"}, Exec: []string{"--"}},
+}
+
+// The built-in profiles, along with these loaded from the terminals.json file
+var terminalProfiles = builtInTerminalProfiles
+
+// Used for terminals we know nothing about
+var defaultTerminalProfile = terminalProfile{Exec: []string{"-e"}}
+
+// loadTerminalProfiles overrides or extends the built-in table with the content of a json file, e.g.:
+// {"myterm": {"title": ["-T", "%s"], "exec": ["-x"]}}. Profiles loaded from the file before are dropped.
+func loadTerminalProfiles(path string) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var profiles map[string]terminalProfile
+	err = json.Unmarshal(bytes, &profiles)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]terminalProfile)
+	for name, profile := range builtInTerminalProfiles {
+		merged[name] = profile
+	}
+	for name, profile := range profiles {
+		merged[name] = profile
+	}
+	terminalProfiles = merged
+	log.Infof("Loaded %v terminal profiles from %s", len(profiles), path)
+
+	return nil
+}
+
+// detectTerminal returns the terminal emulator to use, if the -term argument was not given:
+// $TERMINAL, xdg-terminal-exec if installed, $TERM if it's an executable, and foot as the last resort.
+func detectTerminal() string {
+	candidates := []string{
+		os.Getenv("TERMINAL"),
+		"xdg-terminal-exec",
+		defaultTermIfBlank(os.Getenv("TERM"), ""),
+	}
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		parts, err := shlex.Split(c)
+		if err != nil || len(parts) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(parts[0]); err == nil {
+			return c
+		}
+	}
+	return "foot"
+}
+
+// terminalCommand returns the command to run the argv in the terminal emulator
+func terminalCommand(terminal string, argv []string, title, appID string) *exec.Cmd {
+	parts, err := shlex.Split(terminal)
+	if err != nil || len(parts) == 0 {
+		log.Warnf("Invalid terminal command %q, using foot", terminal)
+		parts = []string{"foot"}
+	}
+
+	profile, ok := terminalProfiles[filepath.Base(parts[0])]
+	if !ok {
+		profile = defaultTerminalProfile
+	}
+
+	args := append(parts[1:], profile.Args...)
+	if title != "" {
+		args = append(args, fillTemplate(profile.Title, title)...)
+	}
+	if appID != "" {
+		args = append(args, fillTemplate(profile.AppID, appID)...)
+	}
+	args = append(args, profile.Exec...)
+	args = append(args, argv...)
+
+	return exec.Command(parts[0], args...)
+}
+
+func fillTemplate(template []string, value string) []string {
+	var result []string
+	for _, t := range template {
+		result = append(result, strings.ReplaceAll(t, "%s", value))
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectTerminal(t *testing.T) {
+	bin := t.TempDir()
+	for _, name := range []string{"kitty", "alacritty", "xdg-terminal-exec"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noXdg := t.TempDir()
+	if err := os.WriteFile(filepath.Join(noXdg, "alacritty"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path, terminal, term string
+		expected             string
+	}{
+		{bin, "kitty", "alacritty", "kitty"},
+		{bin, "kitty --single-instance", "", "kitty --single-instance"},
+		{bin, "not-installed", "alacritty", "xdg-terminal-exec"},
+		{bin, "", "alacritty", "xdg-terminal-exec"},
+		{noXdg, "", "alacritty", "alacritty"},
+		{noXdg, "", "xterm-256color", "foot"},
+		{noXdg, "", "linux", "foot"},
+		{noXdg, `"unclosed`, "", "foot"},
+	} {
+		t.Setenv("PATH", c.path)
+		t.Setenv("TERMINAL", c.terminal)
+		t.Setenv("TERM", c.term)
+		if got := detectTerminal(); got != c.expected {
+			t.Errorf("TERMINAL=%q TERM=%q: expected %q, got %q", c.terminal, c.term, c.expected, got)
+		}
+	}
+}
+
+func TestTerminalCommand(t *testing.T) {
+	for _, c := range []struct {
+		terminal     string
+		title, appID string
+		expected     []string
+	}{
+		{"foot", "Top", "top", []string{"foot", "--title=Top", "--app-id=top", "htop", "-d", "5"}},
+		{"kitty", "Top", "top", []string{"kitty", "--title", "Top", "--class", "top", "--", "htop", "-d", "5"}},
+		{"alacritty", "", "", []string{"alacritty", "-e", "htop", "-d", "5"}},
+		{"wezterm", "Top", "top", []string{"wezterm", "start", "--class", "top", "--", "htop", "-d", "5"}},
+		{"/usr/bin/xdg-terminal-exec", "Top", "top", []string{"/usr/bin/xdg-terminal-exec", "--title=Top",
+			"--app-id=top", "--", "htop", "-d", "5"}},
+		{"kitty --single-instance", "", "top", []string{"kitty", "--single-instance", "--class", "top", "--", "htop",
+			"-d", "5"}},
+		// terminals we don't know get -e, and no title
+		{"myterm --flag", "Top", "top", []string{"myterm", "--flag", "-e", "htop", "-d", "5"}},
+		{`"unclosed`, "", "", []string{"foot", "htop", "-d", "5"}},
+	} {
+		cmd := terminalCommand(c.terminal, []string{"htop", "-d", "5"}, c.title, c.appID)
+		if !reflect.DeepEqual(cmd.Args, c.expected) {
+			t.Errorf("%s: expected %q, got %q", c.terminal, c.expected, cmd.Args)
+		}
+	}
+}
+
+func TestLoadTerminalProfiles(t *testing.T) {
+	defer func() { terminalProfiles = builtInTerminalProfiles }()
+	path := filepath.Join(t.TempDir(), "terminals.json")
+
+	if err := os.WriteFile(path, []byte(`{"myterm": {"exec": ["-x"]}, "foot": {"exec": ["--"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTerminalProfiles(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := terminalProfiles["myterm"]; !ok || terminalProfiles["foot"].Exec[0] != "--" {
+		t.Errorf("profiles from the file should be used, got %+v", terminalProfiles)
+	}
+
+	// edited: profiles removed from the file are gone, and built-in ones are back
+	if err := os.WriteFile(path, []byte(`{"otherterm": {"exec": ["-x"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTerminalProfiles(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := terminalProfiles["myterm"]; ok {
+		t.Error("myterm should be dropped")
+	}
+	if _, ok := terminalProfiles["otherterm"]; !ok {
+		t.Error("otherterm should be loaded")
+	}
+	if !reflect.DeepEqual(terminalProfiles["foot"], builtInTerminalProfiles["foot"]) {
+		t.Errorf("expected the built-in foot profile, got %+v", terminalProfiles["foot"])
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File search results may show thumbnails from the cache shared by file managers and image viewers, as described
+// in the freedesktop Thumbnail Managing Standard: <cache dir>/thumbnails/<size dir>/<MD5 of the file URI>.png.
+// We never create thumbnails, just use what's there.
+
+// size dirs, smallest first
+var thumbnailSizes = []struct {
+	dir  string
+	size int
+}{{"normal", 128}, {"large", 256}, {"x-large", 512}, {"xx-large", 1024}}
+
+// thumbnailsDir returns the shared thumbnail cache dir, or "" if unknown
+func thumbnailsDir() string {
+	if dir := cacheDir(); dir != "" {
+		return filepath.Join(dir, "thumbnails")
+	}
+	return ""
+}
+
+// isThumbnail tells if the file is in the shared thumbnail cache
+func isThumbnail(p string) bool {
+	dir := thumbnailsDir()
+	return dir != "" && strings.HasPrefix(p, dir+"/")
+}
+
+// thumbnailPath returns the thumbnail of the file from the dir, or "" if there's none. The smallest one of at least
+// the size in pixels is preferred, then the biggest smaller one. Thumbnails older than the file are outdated.
+func thumbnailPath(dir, filePath string, modTime time.Time, size int) string {
+	if dir == "" {
+		return ""
+	}
+	var sizeDirs []string
+	for _, s := range thumbnailSizes {
+		if s.size >= size {
+			sizeDirs = append(sizeDirs, s.dir)
+		}
+	}
+	for i := len(thumbnailSizes) - 1; i >= 0; i-- {
+		if thumbnailSizes[i].size < size {
+			sizeDirs = append(sizeDirs, thumbnailSizes[i].dir)
+		}
+	}
+
+	name := fmt.Sprintf("%x.png", md5.Sum([]byte(fileURI(filePath))))
+	for _, sizeDir := range sizeDirs {
+		p := filepath.Join(dir, sizeDir, name)
+		if info, err := os.Stat(p); err == nil && !info.ModTime().Before(modTime) {
+			return p
+		}
+	}
+	return ""
+}
+
+// fileURI returns the file:// URI of the absolute path, escaped the way GLib does it, as thumbnail names depend on it
+func fileURI(p string) string {
+	const allowed = "!$&'()*+,-./:=@_~"
+	var b strings.Builder
+	b.WriteString("file://")
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte(allowed, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
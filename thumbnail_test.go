@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileURI(t *testing.T) {
+	for p, expected := range map[string]string{
+		"/home/user/cat.png":              "file:///home/user/cat.png",
+		"/home/user/My Pictures/kot.png":  "file:///home/user/My%20Pictures/kot.png",
+		"/home/user/żółw;#1.png":          "file:///home/user/%C5%BC%C3%B3%C5%82w%3B%231.png",
+		"/home/user/(draft)_v2+final.odt": "file:///home/user/(draft)_v2+final.odt",
+	} {
+		if got := fileURI(p); got != expected {
+			t.Errorf("%s: expected %s, got %s", p, expected, got)
+		}
+	}
+}
+
+func TestThumbnailPath(t *testing.T) {
+	dir := t.TempDir()
+	filePath := "/home/user/Pictures/cat.png"
+	name := fmt.Sprintf("%x.png", md5.Sum([]byte("file:///home/user/Pictures/cat.png")))
+	modTime := time.Now().Add(-time.Hour)
+
+	writeThumbnail := func(sizeDir string, age time.Duration) string {
+		p := filepath.Join(dir, sizeDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, time.Now().Add(-age), time.Now().Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if got := thumbnailPath(dir, filePath, modTime, 64); got != "" {
+		t.Errorf("expected no thumbnail, got %s", got)
+	}
+	normal := writeThumbnail("normal", 0)
+	large := writeThumbnail("large", 0)
+	// older than the file
+	writeThumbnail("x-large", 2*time.Hour)
+
+	for size, expected := range map[int]string{64: normal, 128: normal, 200: large, 600: large} {
+		if got := thumbnailPath(dir, filePath, modTime, size); got != expected {
+			t.Errorf("%v px: expected %s, got %s", size, expected, got)
+		}
+	}
+	if got := thumbnailPath(dir, "/home/user/Pictures/dog.png", modTime, 64); got != "" {
+		t.Errorf("expected no thumbnail of another file, got %s", got)
+	}
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/joshuarubin/go-sway"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"io/fs"
-	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
@@ -20,8 +18,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/diamondburned/gotk4-layer-shell/pkg/gtklayershell"
 	"github.com/diamondburned/gotk4/pkg/gdk/v3"
 	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v3"
 	"github.com/google/shlex"
 )
@@ -34,7 +35,9 @@ func createPixbuf(icon string, size int) (*gdkpixbuf.Pixbuf, error) {
 	iconTheme := gtk.IconThemeGetDefault()
 
 	if strings.Contains(icon, "/") {
-		pixbuf, err := gdkpixbuf.NewPixbufFromFileAtSize(icon, size, size)
+		pixbuf, err := cachedIcon(iconCachePath(icon, size), icon, func() (*gdkpixbuf.Pixbuf, error) {
+			return gdkpixbuf.NewPixbufFromFileAtSize(icon, size, size)
+		})
 		if err != nil {
 			log.Errorf("%s", err)
 			return nil, err
@@ -46,7 +49,13 @@ func createPixbuf(icon string, size int) (*gdkpixbuf.Pixbuf, error) {
 		icon = strings.Split(icon, ".")[0]
 	}
 
-	pixbuf, err := iconTheme.LoadIcon(icon, size, gtk.IconLookupForceSize)
+	var pixbuf *gdkpixbuf.Pixbuf
+	var err error
+	if info := iconTheme.LookupIcon(icon, size, gtk.IconLookupForceSize); info != nil {
+		pixbuf, err = cachedIcon(iconCachePath(icon, size), info.Filename(), info.LoadIcon)
+	} else {
+		pixbuf, err = iconTheme.LoadIcon(icon, size, gtk.IconLookupForceSize)
+	}
 
 	if err != nil {
 		if strings.HasPrefix(icon, "/") {
@@ -66,15 +75,31 @@ func createPixbuf(icon string, size int) (*gdkpixbuf.Pixbuf, error) {
 	return pixbuf, nil
 }
 
+// xdgUserDirs maps user-dirs.dirs keys to names we use, also in icon names. Other XDG_*_DIR keys are named after
+// the middle part, e.g. XDG_PROJECTS_DIR -> projects.
+var xdgUserDirs = map[string]string{
+	"XDG_DESKTOP_DIR":     "desktop",
+	"XDG_DOCUMENTS_DIR":   "documents",
+	"XDG_DOWNLOAD_DIR":    "downloads",
+	"XDG_MUSIC_DIR":       "music",
+	"XDG_PICTURES_DIR":    "pictures",
+	"XDG_PUBLICSHARE_DIR": "publicshare",
+	"XDG_TEMPLATES_DIR":   "templates",
+	"XDG_VIDEOS_DIR":      "videos",
+}
+
 func mapXdgUserDirs() map[string]string {
 	result := make(map[string]string)
 	home := os.Getenv("HOME")
 
 	result["home"] = home
+	result["desktop"] = filepath.Join(home, "Desktop")
 	result["documents"] = filepath.Join(home, "Documents")
 	result["downloads"] = filepath.Join(home, "Downloads")
 	result["music"] = filepath.Join(home, "Music")
 	result["pictures"] = filepath.Join(home, "Pictures")
+	result["publicshare"] = filepath.Join(home, "Public")
+	result["templates"] = filepath.Join(home, "Templates")
 	result["videos"] = filepath.Join(home, "Videos")
 
 	userDirsFile := filepath.Join(filepath.Join(configHome(), "user-dirs.dirs"))
@@ -83,25 +108,15 @@ func mapXdgUserDirs() map[string]string {
 		log.Info(fmt.Sprintf("Using XDG user dirs from %s", userDirsFile))
 		lines, _ := loadTextFile(userDirsFile)
 		for _, l := range lines {
-			if strings.HasPrefix(l, "XDG_DOCUMENTS_DIR") {
-				result["documents"] = getUserDir(home, l)
+			key, _, found := strings.Cut(l, "=")
+			if !found || !strings.HasPrefix(key, "XDG_") || !strings.HasSuffix(key, "_DIR") {
 				continue
 			}
-			if strings.HasPrefix(l, "XDG_DOWNLOAD_DIR") {
-				result["downloads"] = getUserDir(home, l)
-				continue
-			}
-			if strings.HasPrefix(l, "XDG_MUSIC_DIR") {
-				result["music"] = getUserDir(home, l)
-				continue
-			}
-			if strings.HasPrefix(l, "XDG_PICTURES_DIR") {
-				result["pictures"] = getUserDir(home, l)
-				continue
-			}
-			if strings.HasPrefix(l, "XDG_VIDEOS_DIR") {
-				result["videos"] = getUserDir(home, l)
+			name, ok := xdgUserDirs[key]
+			if !ok {
+				name = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(key, "XDG_"), "_DIR"))
 			}
+			result[name] = getUserDir(home, l)
 		}
 	} else {
 		log.Warnf("userDirsFile %s not found, using defaults", userDirsFile)
@@ -112,11 +127,11 @@ func mapXdgUserDirs() map[string]string {
 
 func getUserDir(home, line string) string {
 	// line is supposed to look like XDG_DOCUMENTS_DIR="$HOME/Dokumenty"
-	result := strings.Split(line, "=")[1]
-	result = strings.Replace(result, "$HOME", home, 1)
+	_, result, _ := strings.Cut(line, "=")
+	result = strings.Replace(strings.Trim(result, "\""), "$HOME", home, 1)
 
-	// trim ""
-	return result[1 : len(result)-1]
+	// "$HOME/" means the dir is disabled; let's make it comparable with home
+	return filepath.Clean(result)
 }
 
 func cacheDir() string {
@@ -249,7 +264,19 @@ func dataDir() string {
 	return ""
 }
 
+// getAppDirs returns existing directories we look for .desktop files in
 func getAppDirs() []string {
+	var confirmedDirs []string
+	for _, d := range allAppDirs() {
+		if pathExists(d) {
+			confirmedDirs = append(confirmedDirs, d)
+		}
+	}
+	return confirmedDirs
+}
+
+// allAppDirs returns all the directories .desktop files may be found in, existing or not
+func allAppDirs() []string {
 	var dirs []string
 
 	home := os.Getenv("HOME")
@@ -270,17 +297,11 @@ func getAppDirs() []string {
 		"/var/lib/flatpak/exports/share/applications"}
 
 	for _, d := range flatpakDirs {
-		if pathExists(d) && !isIn(dirs, d) {
+		if !isIn(dirs, d) {
 			dirs = append(dirs, d)
 		}
 	}
-	var confirmedDirs []string
-	for _, d := range dirs {
-		if pathExists(d) {
-			confirmedDirs = append(confirmedDirs, d)
-		}
-	}
-	return confirmedDirs
+	return dirs
 }
 
 func loadPreferredApps(path string) (map[string]interface{}, error) {
@@ -396,90 +417,60 @@ func setUpCategories() {
 	categories = append(categories, other)
 }
 
+// Parsed entries by the .desktop file path, so that we only need to re-parse files that changed
+var entriesByPath = make(map[string]desktopEntry)
+
 func parseDesktopFiles(desktopFiles []string) string {
-	desktopEntries = nil
-	id2entry = make(map[string]desktopEntry)
-	skipped := 0
-	hidden := 0
+	entriesByPath = make(map[string]desktopEntry)
 	for _, file := range desktopFiles {
-		id := filepath.Base(file)
-		if _, ok := id2entry[id]; ok {
-			skipped++
-			continue
-		}
-
-		entry, err := parseDesktopEntryFile(id, file)
+		entry, err := parseDesktopEntryCached(filepath.Base(file), file)
 		if err != nil {
 			continue
 		}
+		entriesByPath[file] = entry
+	}
 
-		if entry.NoDisplay {
-			hidden++
-			// We still need hidden entries, so `continue` is disallowed here
-			// Fixes bug introduced in #19
+	if entriesCache != nil {
+		entriesCache.prune(desktopFiles)
+		if err := entriesCache.save(); err != nil {
+			log.Warnf("Couldn't save entry cache: %s", err)
 		}
-
-		id2entry[entry.DesktopID] = entry
-		desktopEntries = append(desktopEntries, entry)
-		assignToLists(entry.DesktopID, entry.Category)
 	}
-	sort.Slice(desktopEntries, func(i, j int) bool {
-		return strings.ToLower(desktopEntries[i].NameLoc) < strings.ToLower(desktopEntries[j].NameLoc)
-	})
-	summary := fmt.Sprintf("%v entries (+%v hidden)", len(desktopEntries)-hidden, hidden)
-	log.Infof("Skipped %v duplicates; %v .desktop entries hidden by \"NoDisplay=true\"", skipped, hidden)
-	return summary
-}
-
-// freedesktop Main Categories list consists of 13 entries. Let's contract it to 8+1 ("Other").
-func assignToLists(desktopID, categories string) {
-	cats := strings.Split(categories, ";")
-	assigned := false
-	for _, cat := range cats {
-		if cat == "Utility" && !isIn(listUtility, desktopID) {
-			listUtility = append(listUtility, desktopID)
-			assigned = true
-			continue
-		}
-		if cat == "Development" && !isIn(listDevelopment, desktopID) {
-			listDevelopment = append(listDevelopment, desktopID)
-			assigned = true
-			continue
-		}
-		if cat == "Game" && !isIn(listGame, desktopID) {
-			listGame = append(listGame, desktopID)
-			assigned = true
-			continue
-		}
-		if cat == "Graphics" && !isIn(listGraphics, desktopID) {
-			listGraphics = append(listGraphics, desktopID)
-			assigned = true
-			continue
-		}
-		if cat == "Network" && !isIn(listInternetAndNetwork, desktopID) {
-			listInternetAndNetwork = append(listInternetAndNetwork, desktopID)
-			assigned = true
+	return apps.SetEntries(entriesByPath, appDirs)
+}
+
+// updateDesktopFiles re-parses the given files, or forgets them if they're gone. Returns the summary, and IDs
+// of entries that may have changed.
+func updateDesktopFiles(paths []string) (string, []string) {
+	var ids []string
+	for _, file := range paths {
+		if !isIn(appDirs, filepath.Dir(file)) {
+			// we don't look into subdirectories
 			continue
 		}
-		if isIn([]string{"Office", "Science", "Education"}, cat) && !isIn(listOffice, desktopID) {
-			listOffice = append(listOffice, desktopID)
-			assigned = true
-			continue
+		id := filepath.Base(file)
+		if !isIn(ids, id) {
+			ids = append(ids, id)
 		}
-		if isIn([]string{"AudioVideo", "Audio", "Video"}, cat) && !isIn(listAudioVideo, desktopID) {
-			listAudioVideo = append(listAudioVideo, desktopID)
-			assigned = true
-			continue
+		if pathExists(file) {
+			entry, err := parseDesktopEntryCached(id, file)
+			if err == nil {
+				entriesByPath[file] = entry
+				continue
+			}
 		}
-		if isIn([]string{"Settings", "System", "DesktopSettings", "PackageManager"}, cat) && !isIn(listSystemTools, desktopID) {
-			listSystemTools = append(listSystemTools, desktopID)
-			assigned = true
-			continue
+		delete(entriesByPath, file)
+		if entriesCache != nil {
+			entriesCache.forget(file)
 		}
 	}
-	if categories != "" && !assigned && !isIn(listOther, desktopID) {
-		listOther = append(listOther, desktopID)
+	if entriesCache != nil {
+		if err := entriesCache.save(); err != nil {
+			log.Warnf("Couldn't save entry cache: %s", err)
+		}
 	}
+	log.Debugf("Re-parsed %v .desktop files", len(paths))
+	return apps.SetEntries(entriesByPath, appDirs), ids
 }
 
 func isIn(slice []string, val string) bool {
@@ -517,26 +508,6 @@ func loadTextFile(path string) ([]string, error) {
 	return output, nil
 }
 
-func pinItem(itemID string) {
-	for _, item := range pinned {
-		if item == itemID {
-			log.Warnf("%s already pinned", itemID)
-			return
-		}
-	}
-	pinned = append(pinned, itemID)
-	savePinned()
-	log.Infof("%s pinned", itemID)
-}
-
-func unpinItem(itemID string) {
-	if isIn(pinned, itemID) {
-		pinned = remove(pinned, itemID)
-		savePinned()
-		log.Infof("%s unpinned", itemID)
-	}
-}
-
 func remove(s []string, r string) []string {
 	for i, v := range s {
 		if v == r {
@@ -546,39 +517,106 @@ func remove(s []string, r string) []string {
 	return s
 }
 
-func savePinned() {
-	f, err := os.OpenFile(pinnedFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		log.Fatal(err)
-	}
+// launchEntry starts the app defined by a desktop entry. If the entry declares StartupNotify=true, we obtain
+// an activation token from the compositor, so that the launched app is allowed to take focus.
+func launchEntry(entry desktopEntry, terminate bool) {
+	launchDesktopAction(entry, "", terminate)
+}
 
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			log.Errorf("Error closing file: %v", f)
+// launchDesktopAction runs the [Desktop Action <actionID>] of the entry, or the entry itself if actionID == "".
+// Entries marked with DBusActivatable=true are started over D-Bus, if the bus knows their name.
+func launchDesktopAction(entry desktopEntry, actionID string, terminate bool) {
+	command := entry.Exec
+	for _, action := range entry.Actions {
+		if action.ID == actionID {
+			command = action.Exec
 		}
-	}(f)
+	}
 
-	for _, line := range pinned {
-		//skip invalid lines
-		if line != "" && id2entry[line].DesktopID != "" {
-			_, err := f.WriteString(line + "\n")
+	token := ""
+	// In terminal apps, the window to be activated belongs to the terminal emulator, which we assume to support it.
+	if entry.StartupNotify || entry.Terminal || entry.DBusActivatable {
+		token = activationToken(entry)
+	}
 
-			if err != nil {
-				log.Error("Error saving pinned", err)
+	if entry.DBusActivatable {
+		err := dbusActivate(entry, actionID, nil, token)
+		if err == nil {
+			if terminate {
+				if *resident {
+					restoreStateAndHide()
+				} else {
+					gtk.MainQuit()
+				}
 			}
+			return
 		}
+		log.Warnf("D-Bus activation of %s failed, running the Exec line: %s", entry.DesktopID, err)
 	}
+
+	launchCommand(entryLaunchRequest(entry, trimFieldCodes(command), token), terminate)
 }
 
-func launch(command string, terminal bool, terminate bool) {
-	// trim % and everything afterwards
-	if strings.Contains(command, "%") {
-		cutAt := strings.Index(command, "%")
-		if cutAt != -1 {
-			command = command[:cutAt-1]
+// openWithEntry opens the file with the app defined by the desktop entry
+func openWithEntry(entry desktopEntry, filePath string) {
+	token := activationToken(entry)
+	if entry.DBusActivatable {
+		uri := (&url.URL{Scheme: "file", Path: filePath}).String()
+		err := dbusActivate(entry, "", []string{uri}, token)
+		if err == nil {
+			if *resident {
+				restoreStateAndHide()
+			} else {
+				gtk.MainQuit()
+			}
+			return
 		}
+		log.Warnf("D-Bus activation of %s failed, running the Exec line: %s", entry.DesktopID, err)
+	}
+
+	launchCommand(entryLaunchRequest(entry, expandFileFieldCodes(entry.Exec, filePath), token), true)
+}
+
+// activationToken returns an xdg-activation token (on Wayland) or a startup notification ID (on X11),
+// requested by GDK on behalf of our (layer shell) window, which is supposed to hold the keyboard focus right now.
+func activationToken(entry desktopEntry) string {
+	display := gdk.DisplayGetDefault()
+	if display == nil {
+		return ""
+	}
+	ctx := display.AppLaunchContext()
+	ctx.SetTimestamp(gtk.GetCurrentEventTime())
+	if win != nil {
+		ctx.SetScreen(win.Screen())
 	}
+	if entry.Icon != "" && !strings.Contains(entry.Icon, "/") {
+		ctx.SetIconName(entry.Icon)
+	}
+
+	info, err := gio.AppInfoCreateFromCommandline(entry.Exec, entry.Name, gio.AppInfoCreateSupportsStartupNotification)
+	if err != nil {
+		log.Debugf("Couldn't create AppInfo for %s: %s", entry.DesktopID, err)
+		return ""
+	}
+
+	token := ctx.StartupNotifyID(info, nil)
+	log.Debugf("Activation token for %s: %q", entry.DesktopID, token)
+	return token
+}
+
+func launch(command string, terminal bool, terminate bool) {
+	launchCommand(launchRequest{Command: trimFieldCodes(command), Terminal: terminal}, terminate)
+}
+
+// launchCommand runs the request. Field codes must be expanded or trimmed already: a % left in the command,
+// e.g. in a file name, is a part of it.
+func launchCommand(req launchRequest, terminate bool) {
+	command := req.Command
+	terminal := req.Terminal
+	env := req.Env
+
+	// as the user knows it, w/o variables prepended below
+	userCommand := command
 
 	if *wm != "uwsm" {
 		themeToPrepend := ""
@@ -592,6 +630,15 @@ func launch(command string, terminal bool, terminate bool) {
 		if themeToPrepend != "" {
 			command = fmt.Sprintf("GTK_THEME=%q %s", themeToPrepend, command)
 		}
+
+		// Programs spawned by the compositor won't inherit our environment, so we pass variables the same way
+		// as GTK_THEME. Terminal emulators get them from cmd.Env below.
+		if !terminal {
+			for _, e := range env {
+				key, value, _ := strings.Cut(e, "=")
+				command = fmt.Sprintf("%s=%q %s", key, value, command)
+			}
+		}
 	} else {
 		if *forceTheme {
 			log.Warn("We can't force GTK_THEME= while running a command through uwsm")
@@ -603,35 +650,25 @@ func launch(command string, terminal bool, terminate bool) {
 	cmd := exec.Command(elements[0], elements[1:]...)
 
 	if terminal {
-		var prefixCommand = *term
-		var args []string
-		if prefixCommand != "foot" {
-			args = []string{"-e", command}
-		} else {
-			args = elements
-		}
-		cmd = exec.Command(prefixCommand, args...)
-	} else if *wm == "sway" {
-		if _, ok := os.LookupEnv("SWAYSOCK"); ok {
-			cmd = exec.Command("swaymsg", "exec", strings.Join(elements, " "))
-		} else {
-			log.Warn("Unable to find SWAYSOCK, running command directly")
+		cmd = terminalCommand(*term, elements, req.Title, req.AppID)
+	} else if backend := newCompositor(*wm); backend != nil {
+		log.Infof("Spawning through %s IPC: %q", backend.Name(), elements)
+		err := backend.Spawn(elements)
+		if err != nil {
+			showLaunchError(&launchError{Command: userCommand, Err: err})
+			return
 		}
-	} else if *wm == "hyprland" || *wm == "Hyprland" {
-		if _, ok := os.LookupEnv("HYPRLAND_INSTANCE_SIGNATURE"); ok {
-			cmd = exec.Command("hyprctl", "dispatch", "exec", strings.Join(elements, " "))
-		} else {
-			log.Warn("Unable to find HYPRLAND_INSTANCE_SIGNATURE, running command directly")
+		if terminate {
+			if *resident {
+				restoreStateAndHide()
+			} else {
+				gtk.MainQuit()
+			}
 		}
+		return
 	} else if *wm == "river" {
 		// a check if we're actually on river would be of use here, but we have none
 		cmd = exec.Command("riverctl", "spawn", strings.Join(elements, " "))
-	} else if *wm == "niri" {
-		if os.Getenv("XDG_CURRENT_DESKTOP") == "niri" {
-			cmd = exec.Command("niri", append([]string{"msg", "action", "spawn", "--"}, elements...)...)
-		} else {
-			log.Warn("$XDG_CURRENT_DESKTOP != 'niri', running command directly")
-		}
 	} else if *wm == "uwsm" {
 		if _, err := exec.LookPath("uwsm"); err == nil {
 			cParts, _ := shlex.Split(command)
@@ -647,22 +684,63 @@ func launch(command string, terminal bool, terminate bool) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setsid: true,
 	}
+	if len(env) > 0 && (terminal || *wm == "uwsm") {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
-	if cmd.Start() != nil {
-		log.Warn("Unable to launch terminal emulator!")
-	} else {
+	startCommand(cmd, userCommand, terminate)
+}
+
+// launchError describes a command that couldn't be started, or exited with an error right after starting
+type launchError struct {
+	Command string
+	Err     error
+}
+
+func (e *launchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Err)
+}
+
+// We only wait this long for the launched program to fail. Later errors are none of our business.
+const launchGracePeriod = time.Second
+
+// startCommand starts the command, and hides the drawer (or quits) if terminate is set. If the command fails
+// to start, or exits with an error within launchGracePeriod, the error is shown in the drawer, which stays open.
+func startCommand(cmd *exec.Cmd, command string, terminate bool) {
+	if err := cmd.Start(); err != nil {
+		showLaunchError(&launchError{Command: command, Err: err})
+		return
+	}
+
+	exited := make(chan error, 1)
+	go func() {
 		// Collect the exit code of the child process to prevent zombies
 		// if the drawer runs in resident mode
-		go func() {
-			_ = cmd.Wait()
-		}()
-	}
+		exited <- cmd.Wait()
+	}()
+
+	go func() {
+		select {
+		case err := <-exited:
+			if err != nil {
+				glib.IdleAdd(func() {
+					showLaunchError(&launchError{Command: command, Err: err})
+				})
+				return
+			}
+		case <-time.After(launchGracePeriod):
+		}
+		if terminate && !*resident {
+			glib.IdleAdd(gtk.MainQuit)
+		}
+	}()
 
 	if terminate {
 		if *resident {
 			restoreStateAndHide()
-		} else {
-			gtk.MainQuit()
+		} else if win != nil {
+			// We'll quit when the grace period ends, or show the window again if the program fails
+			win.Hide()
 		}
 	}
 }
@@ -675,7 +753,13 @@ func open(filePath string, xdgOpen bool) {
 		for key, element := range preferredApps {
 			r, err := regexp.Compile(key)
 			if err == nil && r.MatchString(filePath) {
-				cmd = exec.Command(fmt.Sprintf("%v", element), filePath)
+				app := fmt.Sprintf("%v", element)
+				// The association may also point to a desktop file ID, e.g. "org.gnome.Evince.desktop"
+				if entry, ok := apps.ByID[app]; ok {
+					openWithEntry(entry, filePath)
+					return
+				}
+				cmd = exec.Command(app, filePath)
 				break
 			}
 		}
@@ -684,72 +768,150 @@ func open(filePath string, xdgOpen bool) {
 	}
 	log.Infof("Executing: %s", cmd)
 
-	if cmd.Start() != nil {
-		log.Warn("Unable to execute command!")
-	} else {
-		// Collect the exit code of the child process to prevent zombies
-		// if the drawer runs in resident mode
-		go func() {
-			_ = cmd.Wait()
-		}()
-	}
+	startCommand(cmd, cmd.String(), true)
+}
 
-	if *resident {
-		restoreStateAndHide()
-	} else {
-		gtk.MainQuit()
+// openRecentFile opens the file with the app that opened it last, if we know how to run it, or as open does
+func openRecentFile(file recentFile) {
+	if entry, ok := file.App.appEntry(apps); ok {
+		openWithEntry(entry, file.Path)
+		return
+	}
+	if file.App.Exec != "" {
+		req := launchRequest{Command: expandFileFieldCodes(file.App.Exec, file.Path)}
+		log.Infof("Opening %s with %s", file.Path, file.App.Name)
+		launchCommand(req, true)
+		return
 	}
+	open(file.Path, true)
 }
 
-// Returns map output name -> gdk.Monitor
-func mapOutputs() (map[string]*gdk.Monitor, error) {
-	result := make(map[string]*gdk.Monitor)
+// assignToOutput puts the layer surface on the output of the given name, or on the focused one if name == "focused".
+// Returns false if the output couldn't be found.
+func assignToOutput(name string) bool {
+	if name == "focused" {
+		backend := detectCompositor()
+		if backend == nil {
+			log.Warn("Can't determine the focused output: no IPC of a known compositor found")
+			return false
+		}
+		focused, err := backend.FocusedOutput()
+		if err != nil {
+			log.Errorf("Can't determine the focused output: %s", err)
+			return false
+		}
+		name = focused
+	}
 
-	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" {
-		err := listHyprlandMonitors()
-		if err == nil {
+	// We want to assign layershell to a monitor, but we only know the output name!
+	output2mon, err := mapOutputs()
+	log.Debugf("output2mon: %v", output2mon)
+	if err != nil {
+		log.Errorf("%s", err)
+		return false
+	}
+	if mon, ok := output2mon[name]; ok {
+		log.Debugf("Assigning the window to output %s", name)
+		gtklayershell.SetMonitor(win, mon)
+		return true
+	}
+	log.Errorf("Output %s not found, using the default one", name)
+	return false
+}
+
+// We wait for the outputs configuration to settle, before looking for our output
+const monitorsChangedDelay = 500
 
-			display := gdk.DisplayGetDefault()
+var monitorsChanged uint
 
-			num := display.NMonitors()
-			for i := 0; i < num; i++ {
-				mon := display.Monitor(i)
-				output := hyprlandMonitors[i]
-				result[output.Name] = mon
+// watchMonitors moves the window to a valid output, when outputs get connected or disconnected
+func watchMonitors() {
+	display := gdk.DisplayGetDefault()
+	onChange := func(monitor *gdk.Monitor, what string) {
+		log.Infof("Monitor %s: %s", what, monitor.Model())
+		// hotplugging tends to come in bursts
+		monitorsChanged++
+		current := monitorsChanged
+		glib.TimeoutAdd(monitorsChangedDelay, func() bool {
+			if current == monitorsChanged {
+				reassignOutput()
 			}
-		} else {
-			return nil, err
-		}
+			return false
+		})
+	}
+	display.ConnectMonitorAdded(func(monitor *gdk.Monitor) {
+		onChange(monitor, "added")
+	})
+	display.ConnectMonitorRemoved(func(monitor *gdk.Monitor) {
+		onChange(monitor, "removed")
+	})
+}
 
-	} else if os.Getenv("SWAYSOCK") != "" {
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-		defer cancel()
+// reassignOutput puts the window back on the -o output, or on the first monitor if the output is gone. The window
+// we might be displaying must be hidden and shown again, to create the layer surface on the new output. Without -o,
+// there's nothing to do: the compositor picks the output.
+func reassignOutput() {
+	if win == nil || *targetOutput == "" {
+		return
+	}
 
-		client, err := sway.New(ctx)
-		if err != nil {
-			return nil, err
-		}
+	visible := win.IsVisible()
+	if visible {
+		win.Hide()
+	}
 
-		outputs, err := client.GetOutputs(ctx)
-		if err != nil {
-			return nil, err
+	if !assignToOutput(*targetOutput) {
+		display := gdk.DisplayGetDefault()
+		if display.NMonitors() == 0 {
+			log.Warn("No monitors left, waiting for one to show up")
+			return
 		}
+		gtklayershell.SetMonitor(win, display.Monitor(0))
+	}
 
-		display := gdk.DisplayGetDefault()
-		if err != nil {
-			return nil, err
+	if visible {
+		select {
+		case showWindowChannel <- struct{}{}:
+		default:
 		}
+	}
+}
+
+// Returns map output name -> gdk.Monitor. We can't rely on the order of monitors, as GDK and the compositor may
+// list them differently, so we match them by position in the layout.
+func mapOutputs() (map[string]*gdk.Monitor, error) {
+	result := make(map[string]*gdk.Monitor)
 
-		num := display.NMonitors()
-		for i := 0; i < num; i++ {
-			mon := display.Monitor(i)
-			output := outputs[i]
-			result[output.Name] = mon
+	var outputs []compositorOutput
+	backend := detectCompositor()
+	if backend != nil {
+		var err error
+		outputs, err = backend.Outputs()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't list outputs: %w", err)
 		}
 	} else {
-		return nil, errors.New("output assignment only supported on sway and Hyprland")
+		// e.g. river: we may only hope for GDK to report connector names as monitor models
+		log.Warn("No IPC of a known compositor found, matching outputs by GDK monitor model")
+	}
+
+	display := gdk.DisplayGetDefault()
+	num := display.NMonitors()
+	for i := 0; i < num; i++ {
+		mon := display.Monitor(i)
+		geometry := mon.Geometry()
+		name, ok := matchOutput(mon.Model(), geometry.X(), geometry.Y(), outputs)
+		if !ok {
+			log.Warnf("Couldn't match monitor %v (%s, %vx%v+%v+%v) with any output", i, mon.Model(),
+				geometry.Width(), geometry.Height(), geometry.X(), geometry.Y())
+			continue
+		}
+		result[name] = mon
 	}
 
+	if len(result) == 0 {
+		return nil, errors.New("couldn't match any monitor with an output")
+	}
 	return result, nil
 }
 
@@ -768,46 +930,3 @@ func substring(s string, start int, end int) string {
 	}
 	return s[startStrIdx:]
 }
-
-func hyprctl(cmd string) ([]byte, error) {
-	his := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
-	xdgRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
-	hyprDir := ""
-	if xdgRuntimeDir != "" {
-		hyprDir = fmt.Sprintf("%s/hypr", xdgRuntimeDir)
-	} else {
-		hyprDir = "/tmp/hypr"
-	}
-
-	socketFile := fmt.Sprintf("%s/%s/.socket.sock", hyprDir, his)
-	conn, err := net.Dial("unix", socketFile)
-	if err != nil {
-		return nil, err
-	}
-
-	message := []byte(cmd)
-	_, err = conn.Write(message)
-	if err != nil {
-		return nil, err
-	}
-
-	reply := make([]byte, 102400)
-	n, err := conn.Read(reply)
-	if err != nil {
-		return nil, err
-	}
-
-	defer conn.Close()
-
-	return reply[:n], nil
-}
-
-func listHyprlandMonitors() error {
-	reply, err := hyprctl("j/monitors")
-	if err != nil {
-		return err
-	} else {
-		err = json.Unmarshal([]byte(reply), &hyprlandMonitors)
-	}
-	return err
-}
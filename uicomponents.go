@@ -1,10 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io/fs"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/diamondburned/gotk4-layer-shell/pkg/gtklayershell"
 
@@ -12,6 +12,8 @@ import (
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v3"
 	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v3"
 )
 
@@ -21,10 +23,10 @@ func setUpPinnedFlowBox() *gtk.FlowBox {
 		pinnedFlowBox = nil
 	}
 	flowBox := gtk.NewFlowBox()
-	if uint(len(pinned)) >= *columnsNumber {
+	if uint(len(pins.Items)) >= *columnsNumber {
 		flowBox.SetMaxChildrenPerLine(*columnsNumber)
-	} else if len(pinned) > 0 {
-		flowBox.SetMaxChildrenPerLine(uint(len(pinned)))
+	} else if len(pins.Items) > 0 {
+		flowBox.SetMaxChildrenPerLine(uint(len(pins.Items)))
 	}
 
 	flowBox.SetColumnSpacing(*itemSpacing)
@@ -33,9 +35,9 @@ func setUpPinnedFlowBox() *gtk.FlowBox {
 	flowBox.SetObjectProperty("name", "pinned-box")
 	flowBox.SetSelectionMode(gtk.SelectionNone)
 
-	if len(pinned) > 0 {
-		for _, desktopID := range pinned {
-			entry := id2entry[desktopID]
+	if len(pins.Items) > 0 {
+		for _, desktopID := range pins.Items {
+			entry := apps.ByID[desktopID]
 			if entry.DesktopID == "" {
 				log.Debugf("Pinned item doesn't seem to exist: %s", desktopID)
 				continue
@@ -70,16 +72,19 @@ func setUpPinnedFlowBox() *gtk.FlowBox {
 			btn.Connect("button-release-event", func(row *gtk.Button, event *gdk.Event) bool {
 				btnEvent := event.AsButton()
 				if btnEvent.Button() == 1 {
-					launch(entry.Exec, entry.Terminal, true)
+					launchEntry(entry, true)
+					return true
+				} else if btnEvent.Button() == 2 && len(entry.Actions) > 0 {
+					actionsMenu(entry).PopupAtWidget(row, gdk.GravityCenter, gdk.GravityNorthWest, event)
 					return true
 				} else if btnEvent.Button() == 3 {
-					unpinItem(entry.DesktopID)
+					pins.Unpin(entry.DesktopID)
 					return true
 				}
 				return false
 			})
 			btn.Connect("activate", func() {
-				launch(entry.Exec, entry.Terminal, true)
+				launchEntry(entry, true)
 			})
 			btn.Connect("enter-notify-event", func() {
 				statusLabel.SetText(entry.CommentLoc)
@@ -98,18 +103,6 @@ func setUpPinnedFlowBox() *gtk.FlowBox {
 }
 
 func setUpCategoriesButtonBox() *gtk.EventBox {
-	lists := map[string][]string{
-		"utility":              listUtility,
-		"development":          listDevelopment,
-		"game":                 listGame,
-		"graphics":             listGraphics,
-		"internet-and-network": listInternetAndNetwork,
-		"office":               listOffice,
-		"audio-video":          listAudioVideo,
-		"system-tools":         listSystemTools,
-		"other":                listOther,
-	}
-
 	eventBox := gtk.NewEventBox()
 
 	hBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
@@ -118,7 +111,7 @@ func setUpCategoriesButtonBox() *gtk.EventBox {
 	button.SetObjectProperty("name", "category-button")
 	button.Connect("clicked", func(item *gtk.Button) {
 		searchEntry.SetText("")
-		appFlowBox = setUpAppsFlowBox(nil, "")
+		apps.SetQuery("", "")
 		for _, btn := range catButtons {
 			btn.SetImagePosition(gtk.PosLeft)
 			btn.SetSizeRequest(0, 0)
@@ -130,19 +123,23 @@ func setUpCategoriesButtonBox() *gtk.EventBox {
 	hBox.PackStart(button, false, false, 0)
 
 	for _, cat := range categories {
-		if isSupposedToShowUp(cat.Name) {
+		if apps.HasVisibleApps(cat.Name) {
 			button = gtk.NewButtonFromIconName(cat.Icon, int(gtk.IconSizeMenu))
 			button.SetObjectProperty("name", "category-button")
 			catButtons = append(catButtons, button)
-			button.SetLabel(cat.DisplayName)
+			if panelMode() {
+				// labels wouldn't fit the panel width
+				button.SetTooltipText(cat.DisplayName)
+			} else {
+				button.SetLabel(cat.DisplayName)
+			}
 			button.SetAlwaysShowImage(true)
 			hBox.PackStart(button, false, false, 0)
 			name := cat.Name
 			b := *button
 			button.Connect("clicked", func(item *gtk.Button) {
 				searchEntry.SetText("")
-				// One day or another we'll add SetFilterFunction here; it was impossible on the gotk3 library
-				appFlowBox = setUpAppsFlowBox(lists[name], "")
+				apps.SetQuery(name, "")
 				for _, btn := range catButtons {
 					btn.SetImagePosition(gtk.PosLeft)
 				}
@@ -158,48 +155,8 @@ func setUpCategoriesButtonBox() *gtk.EventBox {
 	return eventBox
 }
 
-func isSupposedToShowUp(catName string) bool {
-	result := catName == "utility" && notEmpty(listUtility) ||
-		catName == "development" && notEmpty(listDevelopment) ||
-		catName == "game" && notEmpty(listGame) ||
-		catName == "graphics" && notEmpty(listGraphics) ||
-		catName == "internet-and-network" && notEmpty(listInternetAndNetwork) ||
-		catName == "office" && notEmpty(listOffice) ||
-		catName == "audio-video" && notEmpty(listAudioVideo) ||
-		catName == "system-tools" && notEmpty(listSystemTools) ||
-		catName == "other" && notEmpty(listOther)
-
-	return result
-}
-
-func notEmpty(listCategory []string) bool {
-	if len(listCategory) == 0 {
-		return false
-	}
-	for _, desktopID := range listCategory {
-		entry := id2entry[desktopID]
-		if !entry.NoDisplay {
-			return true
-		}
-	}
-	return false
-}
-
-func subsequenceMatch(needle, haystack string) bool {
-	needle = strings.ToLower(strings.TrimSpace(needle))
-	haystack = strings.ToLower(haystack)
-
-	n, h := 0, 0
-	for n < len(needle) && h < len(haystack) {
-		if needle[n] == haystack[h] {
-			n++
-		}
-		h++
-	}
-	return n == len(needle)
-}
-
-func setUpAppsFlowBox(categoryList []string, searchPhrase string) *gtk.FlowBox {
+// setUpAppsFlowBox builds the grid of all the apps. What's actually displayed is up to filterApps.
+func setUpAppsFlowBox() *gtk.FlowBox {
 	if appFlowBox != nil && appFlowBox.Widget.Native() != 0 {
 		log.Debugf("Destroying appFlowBox (native=%x)", appFlowBox.Widget.Native())
 		appFlowBox.Destroy()
@@ -223,31 +180,19 @@ func setUpAppsFlowBox(categoryList []string, searchPhrase string) *gtk.FlowBox {
 	flowBox.SetRowSpacing(*itemSpacing)
 	flowBox.SetHomogeneous(true)
 	flowBox.SetSelectionMode(gtk.SelectionNone)
+	flowBox.SetFilterFunc(func(child *gtk.FlowBoxChild) bool {
+		entry, ok := apps.ByID[appGridIDs[child.Native()]]
+		return ok && apps.Matches(entry)
+	})
+	flowBox.SetSortFunc(func(child1, child2 *gtk.FlowBoxChild) int {
+		return apps.Compare(apps.ByID[appGridIDs[child1.Native()]], apps.ByID[appGridIDs[child2.Native()]])
+	})
 
-	for _, entry := range desktopEntries {
-		if searchPhrase == "" {
-			if !entry.NoDisplay {
-				if categoryList != nil {
-					if isIn(categoryList, entry.DesktopID) {
-						button := flowBoxButton(entry)
-						flowBox.Add(button)
-					}
-				} else {
-					button := flowBoxButton(entry)
-					flowBox.Add(button)
-					button.Parent().(*gtk.FlowBoxChild).SetCanFocus(false)
-				}
-			}
-		} else {
-			needle := strings.ToLower(searchPhrase)
-			if !entry.NoDisplay && (subsequenceMatch(needle, strings.ToLower(entry.NameLoc)) ||
-				strings.Contains(strings.ToLower(entry.CommentLoc), strings.ToLower(searchPhrase)) ||
-				strings.Contains(strings.ToLower(entry.Comment), strings.ToLower(searchPhrase)) ||
-				strings.Contains(strings.ToLower(entry.Exec), strings.ToLower(searchPhrase))) {
-				button := flowBoxButton(entry)
-				flowBox.Add(button)
-				button.Parent().(*gtk.FlowBoxChild).SetCanFocus(false)
-			}
+	appGridChildren = make(map[string]*gtk.FlowBoxChild)
+	appGridIDs = make(map[uintptr]string)
+	for _, entry := range apps.Entries {
+		if !entry.NoDisplay {
+			addAppButton(flowBox, entry)
 		}
 	}
 	appHWrapper = gtk.NewBox(gtk.OrientationHorizontal, 0)
@@ -259,22 +204,66 @@ func setUpAppsFlowBox(categoryList []string, searchPhrase string) *gtk.FlowBox {
 	return flowBox
 }
 
+// addAppButton adds the entry button to the grid; the sort function takes care of the position
+func addAppButton(flowBox *gtk.FlowBox, entry desktopEntry) {
+	button := flowBoxButton(entry)
+	flowBox.Add(button)
+	child := button.Parent().(*gtk.FlowBoxChild)
+	child.SetCanFocus(false)
+	appGridChildren[entry.DesktopID] = child
+	appGridIDs[child.Native()] = entry.DesktopID
+}
+
+// applyAppQuery updates the grid, when the app model query changes
+func applyAppQuery() {
+	if appFlowBox == nil {
+		return
+	}
+	// might have been hidden by the command mode
+	appHWrapper.Show()
+	appFlowBox.InvalidateFilter()
+	appFlowBox.InvalidateSort()
+}
+
+// firstVisibleApp returns the grid item of the best match, or nil
+func firstVisibleApp() *gtk.FlowBoxChild {
+	results := apps.Results()
+	if len(results) == 0 {
+		return nil
+	}
+	return appGridChildren[results[0].DesktopID]
+}
+
+// patchAppGrid replaces buttons of the given entries in the grid, instead of rebuilding it
+func patchAppGrid(ids []string) {
+	if appFlowBox == nil {
+		appFlowBox = setUpAppsFlowBox()
+		return
+	}
+
+	for _, id := range ids {
+		if child, ok := appGridChildren[id]; ok {
+			delete(appGridIDs, child.Native())
+			delete(appGridChildren, id)
+			child.Destroy()
+		}
+	}
+	for _, id := range ids {
+		if entry, ok := apps.ByID[id]; ok && !entry.NoDisplay {
+			addAppButton(appFlowBox, entry)
+			appGridChildren[id].ShowAll()
+		}
+	}
+	log.Debugf("App grid patched: %v", ids)
+}
+
 func flowBoxButton(entry desktopEntry) *gtk.Button {
 	button := gtk.NewButton()
 	button.SetAlwaysShowImage(true)
 
-	var pixbuf *gdkpixbuf.Pixbuf
 	var img *gtk.Image
-	var err error
-
 	if entry.Icon != "" {
-		pixbuf, err = createPixbuf(entry.Icon, *iconSize)
-		if err != nil || pixbuf == nil {
-			log.Warnf("Cannot load icon %q for %q: %v", entry.Icon, entry.Name, err)
-			img = gtk.NewImageFromIconName("image-missing", int(gtk.IconSizeDialog))
-		} else {
-			img = gtk.NewImageFromPixbuf(pixbuf)
-		}
+		img = lazyIcon(entry.Icon, *iconSize)
 	} else {
 		log.Warnf("Undefined icon for %s", entry.Name)
 		img = gtk.NewImageFromIconName("image-missing", int(gtk.IconSizeDialog))
@@ -290,8 +279,6 @@ func flowBoxButton(entry desktopEntry) *gtk.Button {
 	button.SetLabel(name)
 
 	ID := entry.DesktopID
-	exec := entry.Exec
-	terminal := entry.Terminal
 	desc := entry.CommentLoc
 	if len(desc) > 120 {
 		r := substring(desc, 0, 117)
@@ -307,17 +294,20 @@ func flowBoxButton(entry desktopEntry) *gtk.Button {
 		btnEvent := event.AsButton()
 		if btnEvent.Button() == 1 {
 			if !beenScrolled {
-				launch(exec, terminal, true)
+				launchEntry(entry, true)
 				return true
 			}
+		} else if btnEvent.Button() == 2 && len(entry.Actions) > 0 {
+			actionsMenu(entry).PopupAtWidget(btn, gdk.GravityCenter, gdk.GravityNorthWest, event)
+			return true
 		} else if btnEvent.Button() == 3 {
-			pinItem(ID)
+			pins.Pin(ID)
 			return true
 		}
 		return false
 	})
 	button.Connect("activate", func() {
-		launch(exec, terminal, true)
+		launchEntry(entry, true)
 	})
 	button.Connect("enter-notify-event", func() {
 		statusLabel.SetText(desc)
@@ -331,6 +321,22 @@ func flowBoxButton(entry desktopEntry) *gtk.Button {
 	return button
 }
 
+// actionsMenu lists the [Desktop Action] groups of the entry, e.g. "New Private Window"
+func actionsMenu(entry desktopEntry) *gtk.Menu {
+	menu := gtk.NewMenu()
+	for _, action := range entry.Actions {
+		item := gtk.NewMenuItemWithLabel(action.NameLoc)
+		actionID := action.ID
+		item.Connect("activate", func() {
+			launchDesktopAction(entry, actionID, true)
+		})
+		menu.Append(item)
+	}
+	menu.ShowAll()
+
+	return menu
+}
+
 func powerButton(iconPathOrName, command string) *gtk.Button {
 	button := gtk.NewButton()
 	button.SetAlwaysShowImage(true)
@@ -407,41 +413,20 @@ func setUpFileSearchResultContainer() *gtk.FlowBox {
 	}
 	flowBox := gtk.NewFlowBox()
 	flowBox.SetObjectProperty("orientation", gtk.OrientationVertical)
+	view := newFileResultView(fileSearchQuery)
+	flowBox.SetFilterFunc(func(child *gtk.FlowBoxChild) bool {
+		c, ok := view.children[child.Native()]
+		return ok && view.displays(c)
+	})
+	flowBox.SetSortFunc(func(child1, child2 *gtk.FlowBoxChild) int {
+		return view.compare(view.children[child1.Native()], view.children[child2.Native()])
+	})
+	fileResults = view
 	fileSearchResultWrapper.PackStart(flowBox, false, false, 10)
 
 	return flowBox
 }
 
-func walk(path string, d fs.DirEntry, e error) error {
-	if e != nil {
-		return e
-	}
-	// don't search leading part of the path, as e.g. '/home/user/Pictures'
-	toSearch := strings.Split(path, ignore)[1]
-
-	// Remaining part of the path (w/o file name) must be checked against being present in excluded dirs
-	doSearch := true
-	parts := strings.Split(toSearch, "/")
-	remainingPart := ""
-	if len(parts) > 1 {
-		remainingPart = strings.Join(parts[:len(parts)-1], "/")
-	}
-	if remainingPart != "" && isExcluded(remainingPart) {
-		doSearch = false
-	}
-
-	if doSearch && strings.Contains(strings.ToLower(toSearch), strings.ToLower(phrase)) {
-		// mark directories
-		if d.IsDir() {
-			fileSearchResults = append(fileSearchResults, fmt.Sprintf("#is_dir#%s", path))
-		} else {
-			fileSearchResults = append(fileSearchResults, path)
-		}
-	}
-
-	return nil
-}
-
 func setUpSearchEntry() *gtk.SearchEntry {
 	sEntry := gtk.NewSearchEntry()
 	sEntry.SetPlaceholderText("Type to search")
@@ -457,14 +442,10 @@ func setUpSearchEntry() *gtk.SearchEntry {
 			// Check if command input
 			if phrase[0] == ':' {
 				// Hide/Destroy everything except "execute command"
-				if appFlowBox != nil && appFlowBox.Widget.Native() != 0 {
-					log.Debugf("Destroying appFlowBox (native=%x)", appFlowBox.Widget.Native())
-					appFlowBox.Destroy()
-					appFlowBox = nil
-				} else {
-					log.Debugf("Skipping appFlowBox.Destroy(); already invalid or nil")
-					appFlowBox = nil
+				if appHWrapper != nil {
+					appHWrapper.Hide()
 				}
+				stopFileSearch()
 				if pinnedFlowBox != nil && pinnedFlowBox.Visible() {
 					pinnedFlowBox.Hide()
 				}
@@ -482,68 +463,19 @@ func setUpSearchEntry() *gtk.SearchEntry {
 			}
 
 			// search apps
-			appFlowBox = setUpAppsFlowBox(nil, phrase)
+			apps.SetQuery("", phrase)
 
 			// search files
 			if !*noFS && len(phrase) > 2 {
-				if fileSearchResultFlowBox != nil {
-					fileSearchResultFlowBox.Destroy()
-					fileSearchResultFlowBox = nil
-				}
-
-				fileSearchResultFlowBox = setUpFileSearchResultContainer()
-
-				for key := range userDirsMap {
-					if key != "home" {
-						fileSearchResults = nil
-						searchUserDir(key)
-					}
-				}
-				if len(fileSearchResultFlowBox.Children()) == 0 {
-					fileSearchResultWrapper.Hide()
-					statusLabel.SetText("0 results")
-				}
+				startFileSearch(phrase)
 			} else {
 				// search phrase too short
-				if fileSearchResultFlowBox != nil {
-					fileSearchResultFlowBox.Destroy()
-					fileSearchResultFlowBox = nil
-				}
-				if fileSearchResultWrapper != nil {
-					fileSearchResultWrapper.Hide()
-				}
-			}
-			// focus 1st search result #17
-			var w *gtk.Button
-			if appFlowBox != nil {
-				b := appFlowBox.ChildAtIndex(0)
-				if b != nil {
-					button := b.Child().(*gtk.Button)
-					button.SetCanFocus(true)
-					button.GrabFocus()
-					w = button
-				}
-			}
-			if w == nil && fileSearchResultFlowBox != nil {
-				f := fileSearchResultFlowBox.ChildAtIndex(0)
-				if f != nil {
-					button := f.Child().(*gtk.Box)
-					button.SetCanFocus(true)
-					button.GrabFocus()
-				}
+				stopFileSearch()
 			}
 		} else {
 			// clear search results
-			appFlowBox = setUpAppsFlowBox(nil, "")
-
-			if fileSearchResultFlowBox != nil {
-				fileSearchResultFlowBox.Destroy()
-				fileSearchResultFlowBox = nil
-			}
-
-			if fileSearchResultWrapper != nil {
-				fileSearchResultWrapper.Hide()
-			}
+			apps.SetQuery("", "")
+			showRecentFiles()
 
 			if !pinnedFlowBox.Visible() {
 				pinnedFlowBox.ShowAll()
@@ -558,55 +490,11 @@ func setUpSearchEntry() *gtk.SearchEntry {
 	return sEntry
 }
 
-func isExcluded(dir string) bool {
-	for _, exclusion := range exclusions {
-		if strings.Contains(dir, exclusion) {
-			return true
-		}
-	}
-	return false
-}
-
-func searchUserDir(dir string) {
-	fileSearchResults = nil
-	ignore = userDirsMap[dir]
-	filepath.WalkDir(userDirsMap[dir], walk)
-
-	if len(fileSearchResults) > 0 {
-		btn := setUpUserDirButton(fmt.Sprintf("folder-%s", dir), "", dir, userDirsMap)
-		fileSearchResultFlowBox.Add(btn)
-		btn.Parent().(*gtk.FlowBoxChild).SetCanFocus(false)
-
-		for _, path := range fileSearchResults {
-			log.Debugf("Path: %s", path)
-			partOfPathToShow := strings.Split(path, userDirsMap[dir])[1]
-			if partOfPathToShow != "" {
-				if !(strings.HasPrefix(path, "#is_dir#") && isExcluded(path)) {
-					button := setUpUserFileSearchResultButton(partOfPathToShow, path)
-					if button != nil {
-						fileSearchResultFlowBox.Add(button)
-					}
-					button.Parent().(*gtk.FlowBoxChild).SetCanFocus(false)
-				}
-
-			}
-		}
-		fileSearchResultFlowBox.Hide()
-
-		statusLabel.SetText(fmt.Sprintf("%v results | LMB: xdg-open | RMB: file manager",
-			len(fileSearchResultFlowBox.Children())))
-		num := uint(len(fileSearchResultFlowBox.Children())) / *fsColumns
-		fileSearchResultFlowBox.SetMinChildrenPerLine(num + 1)
-		fileSearchResultFlowBox.SetMaxChildrenPerLine(num + 1)
-
-		fileSearchResultFlowBox.ShowAll()
-	}
-}
-
-func setUpUserDirButton(iconName, displayName, entryName string, userDirsMap map[string]string) *gtk.Box {
+// setUpUserDirButton returns the header of results from the dir; displayName defaults to the dir name.
+// Without the dirPath, the header is not clickable.
+func setUpUserDirButton(iconName, displayName, dirPath string) *gtk.Box {
 	if displayName == "" {
-		parts := strings.Split(userDirsMap[entryName], "/")
-		displayName = parts[(len(parts) - 1)]
+		displayName = filepath.Base(dirPath)
 	}
 	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
 	button := gtk.NewButton()
@@ -618,38 +506,65 @@ func setUpUserDirButton(iconName, displayName, entryName string, userDirsMap map
 		displayName = fmt.Sprintf("%s…", displayName[:*nameLimit-3])
 	}
 	button.SetLabel(displayName)
+	box.PackStart(button, false, true, 0)
+	if dirPath == "" {
+		button.SetRelief(gtk.ReliefNone)
+		button.SetCanFocus(false)
+		return box
+	}
 
 	button.Connect("button-release-event", func(btn *gtk.Button, event *gdk.Event) bool {
 		btnEvent := event.AsButton()
 		if btnEvent.Button() == 1 {
-			open(userDirsMap[entryName], true)
+			open(dirPath, true)
 			return true
 		} else if btnEvent.Button() == 3 {
-			open(userDirsMap[entryName], false)
+			open(dirPath, false)
 			return true
 		}
 		return false
 	})
 
 	button.Connect("activate", func() {
-		open(userDirsMap[entryName], true)
+		open(dirPath, true)
 	})
-
-	box.PackStart(button, false, true, 0)
 	return box
 }
 
-func setUpUserFileSearchResultButton(fileName, filePath string) *gtk.Box {
-	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
-	button := gtk.NewButton()
+// fileIcon returns the thumbnail of the file, if enabled and there's one, or the themed icon of its MIME type
+func fileIcon(filePath string, isDir bool, modTime time.Time) *gtk.Image {
+	size := *fsThumbs
+	if size > 0 && !isDir {
+		scale := 1
+		if win != nil {
+			scale = win.ScaleFactor()
+		}
+		if thumbnail := thumbnailPath(thumbnailsDir(), filePath, modTime, size*scale); thumbnail != "" {
+			return lazyIcon(thumbnail, size)
+		}
+	}
 
-	// in the walk function we've marked directories with the '#is_dir#' prefix
-	if strings.HasPrefix(filePath, "#is_dir#") {
-		filePath = filePath[8:]
-		img := gtk.NewImageFromIconName("folder", int(gtk.IconSizeMenu))
-		button.SetAlwaysShowImage(true)
-		button.SetImage(img)
+	var img *gtk.Image
+	if isDir {
+		img = gtk.NewImageFromIconName("folder", int(gtk.IconSizeMenu))
+	} else {
+		// by the name only, not to read the file
+		_, contentType := gio.ContentTypeGuess(filePath, nil)
+		img = gtk.NewImageFromGIcon(gio.ContentTypeGetIcon(contentType), int(gtk.IconSizeMenu))
 	}
+	if size > 0 {
+		// icons and thumbnails line up
+		img.SetPixelSize(size)
+	}
+	return img
+}
+
+func setUpUserFileSearchResultButton(fileName string, match fileMatch) *gtk.Box {
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	button := gtk.NewButton()
+	button.SetAlwaysShowImage(true)
+	button.SetImage(fileIcon(match.Path, match.IsDir, match.ModTime))
+	filePath := match.Path
 
 	tooltipText := ""
 	if len(fileName) > *nameLimit {
@@ -686,6 +601,117 @@ func setUpUserFileSearchResultButton(fileName, filePath string) *gtk.Box {
 	return box
 }
 
+// setUpRecentFileButton returns the button of the recently used file, with the icon of the app that opened it last,
+// or the file icon if unknown
+func setUpRecentFileButton(file recentFile) *gtk.Box {
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	button := gtk.NewButton()
+	button.SetAlwaysShowImage(true)
+
+	fileName := filepath.Base(file.Path)
+	if len(fileName) > *nameLimit {
+		fileName = fmt.Sprintf("%s…", fileName[:*nameLimit-3])
+	}
+	button.SetLabel(fileName)
+
+	appName := file.App.Name
+	entry, ok := file.App.appEntry(apps)
+	if ok {
+		appName = entry.NameLoc
+	}
+	if ok && entry.Icon != "" {
+		size := 16
+		if *fsThumbs > 0 {
+			size = *fsThumbs
+		}
+		button.SetImage(lazyIcon(entry.Icon, size))
+	} else {
+		button.SetImage(fileIcon(file.Path, file.IsDir, file.ModTime))
+	}
+	tooltipText := file.Path
+	if appName != "" {
+		tooltipText = fmt.Sprintf("%s\nLast opened with %s", file.Path, appName)
+	}
+	button.SetTooltipText(tooltipText)
+
+	button.Connect("button-release-event", func(btn *gtk.Button, event *gdk.Event) bool {
+		btnEvent := event.AsButton()
+		if btnEvent.Button() == 1 {
+			openRecentFile(file)
+			return true
+		} else if btnEvent.Button() == 3 {
+			open(file.Path, false)
+			return true
+		}
+		return false
+	})
+
+	button.Connect("activate", func() {
+		openRecentFile(file)
+	})
+	box.PackStart(button, false, true, 0)
+	return box
+}
+
+// How long the error banner stays visible
+const errorBannerTimeout = 8
+
+var errorBannerShown uint
+
+func setUpErrorBanner() *gtk.InfoBar {
+	infoBar := gtk.NewInfoBar()
+	infoBar.SetObjectProperty("name", "error-banner")
+	infoBar.SetMessageType(gtk.MessageError)
+	infoBar.SetShowCloseButton(true)
+	infoBar.ConnectResponse(func(responseId int) {
+		infoBar.Hide()
+	})
+
+	errorLabel = gtk.NewLabel("")
+	errorLabel.SetObjectProperty("name", "error-label")
+	errorLabel.SetLineWrap(true)
+	infoBar.ContentArea().PackStart(errorLabel, true, true, 0)
+	errorLabel.Show()
+
+	// We'll show it on demand only
+	infoBar.SetNoShowAll(true)
+
+	return infoBar
+}
+
+// showLaunchError displays the error in the banner below the search entry, and shows the window if it's been hidden
+func showLaunchError(err error) {
+	log.Warn(err)
+	if errorBanner == nil {
+		return
+	}
+
+	var le *launchError
+	if errors.As(err, &le) {
+		errorLabel.SetText(fmt.Sprintf("Couldn't launch \"%s\": %s", le.Command, le.Err))
+	} else {
+		errorLabel.SetText(err.Error())
+	}
+	errorBanner.Show()
+
+	errorBannerShown++
+	shown := errorBannerShown
+	glib.TimeoutSecondsAdd(errorBannerTimeout, func() bool {
+		// unless another error came in the meantime
+		if shown == errorBannerShown {
+			errorBanner.Hide()
+		}
+		return false
+	})
+
+	if win != nil && !win.IsVisible() {
+		select {
+		case showWindowChannel <- struct{}{}:
+		default:
+		}
+	}
+}
+
 func setUpOperationResultWindow(operation string, result string) *gtk.Window {
 	window := gtk.NewWindow(gtk.WindowToplevel)
 	window.SetModal(true)
@@ -1,12 +1,15 @@
 package main
 
 import (
-	"os"
+	"fmt"
 	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/diamondburned/gotk4/pkg/gdk/v3"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v3"
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -23,8 +26,16 @@ func watchFiles() {
 		log.Errorf("ERROR: %s", err)
 	}
 
+	// .desktop files in subdirs of app dirs aren't read, see listDesktopFiles
 	for _, fp := range appDirs {
-		if err := filepath.Walk(fp, watchDir); err != nil {
+		if err := watcher.Add(fp); err != nil {
+			log.Errorf("ERROR: %s", err)
+		}
+	}
+
+	// Editors tend to replace files instead of writing them, so we watch directories, not the files themselves
+	for _, dir := range []string{configDirectory, filepath.Dir(*cssFileName)} {
+		if err := watcher.Add(dir); err != nil {
 			log.Errorf("ERROR: %s", err)
 		}
 	}
@@ -35,15 +46,23 @@ func watchFiles() {
 		for {
 			select {
 			case event := <-watcher.Events:
-				if strings.HasSuffix(event.Name, ".desktop") &&
-					(event.Op.String() == "CREATE" ||
-						event.Op.String() == "REMOVE" ||
-						event.Op.String() == "RENAME") {
-					desktopTrigger = true
+				if strings.HasSuffix(event.Name, ".desktop") {
+					// Write & Chmod too: a package upgrade may rename the app, or the user may toggle NoDisplay
+					name := event.Name
+					glib.IdleAdd(func() {
+						if isIn(appDirs, filepath.Dir(name)) {
+							scheduleUpdate(name)
+						}
+					})
 				} else if event.Name == pinnedFile {
 					// TODO: This can be used to propagate information about the changed file to the
 					//       GUI to avoid recreating everything
 					pinnedItemsChanged <- struct{}{}
+				} else if isReloadable(event.Name) && event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) != 0 {
+					name := event.Name
+					glib.IdleAdd(func() {
+						scheduleReload(name)
+					})
 				}
 
 			case err := <-watcher.Errors:
@@ -55,10 +74,225 @@ func watchFiles() {
 	<-done
 }
 
-func watchDir(path string, fi os.FileInfo, err error) error {
-	if fi.Mode().IsDir() {
-		return watcher.Add(path)
+// checkAppDirs starts using app dirs created since we've started, e.g. on the first flatpak installation. Watching
+// their parents instead would mean events from busy dirs as ~/.local/share, so we look whenever the window gets
+// shown; changes to the grid wait for that anyway, see scheduleRefresh. Main loop only.
+func checkAppDirs() {
+	dirs := getAppDirs()
+	appeared := false
+	for _, d := range dirs {
+		if isIn(appDirs, d) {
+			continue
+		}
+		log.Infof("App dir %s appeared", d)
+		if watcher != nil {
+			if err := watcher.Add(d); err != nil {
+				log.Errorf("ERROR: %s", err)
+			}
+		}
+		appeared = true
+	}
+	if appeared {
+		// the order decides which dir wins for a desktop ID, see appModel.SetEntries
+		appDirs = dirs
+		fullRefreshNeeded = true
+		desktopTrigger = true
+	}
+}
+
+// We wait for package managers to finish their job, before we rebuild the app grid
+const rebuildDelay = 1000
+
+var (
+	rebuildsScheduled   uint
+	refreshingApps      bool
+	fullRefreshNeeded   bool
+	changedDesktopFiles = make(map[string]bool)
+)
+
+// watchIconTheme rebuilds the app grid, if the icon theme gets changed, or new icons show up in it
+func watchIconTheme() {
+	gtk.IconThemeGetDefault().ConnectChanged(func() {
+		if !refreshingApps {
+			log.Info("Icon theme changed")
+			forgetIcons()
+			scheduleRebuild()
+		}
+	})
+}
+
+// scheduleRebuild re-reads all the .desktop files and rebuilds the app grid. Must be called on the main loop.
+func scheduleRebuild() {
+	fullRefreshNeeded = true
+	scheduleRefresh()
+}
+
+// scheduleUpdate re-parses the .desktop file and patches the app grid. Must be called on the main loop.
+func scheduleUpdate(path string) {
+	changedDesktopFiles[path] = true
+	scheduleRefresh()
+}
+
+// scheduleRefresh calls refreshApps once the .desktop files stop changing
+func scheduleRefresh() {
+	rebuildsScheduled++
+	current := rebuildsScheduled
+	glib.TimeoutAdd(rebuildDelay, func() bool {
+		if current != rebuildsScheduled {
+			return false
+		}
+		if win != nil && win.IsVisible() {
+			// we don't want to pull the grid from under the user's feet; let's do it on the next show
+			desktopTrigger = true
+		} else {
+			refreshApps()
+		}
+		return false
+	})
+}
+
+// refreshApps applies pending changes: re-parses changed .desktop files and patches the app grid, or rebuilds
+// everything if needed. Pinned items are rebuilt if affected.
+func refreshApps() {
+	// icons may have come with the new apps
+	refreshingApps = true
+	gtk.IconThemeGetDefault().RescanIfNeeded()
+	refreshingApps = false
+
+	if fullRefreshNeeded {
+		log.Debug("Rebuilding apps")
+		status = parseDesktopFiles(listDesktopFiles())
+		appFlowBox = setUpAppsFlowBox()
+		pinnedFlowBox = setUpPinnedFlowBox()
+	} else {
+		var paths []string
+		for p := range changedDesktopFiles {
+			paths = append(paths, p)
+		}
+		var ids []string
+		status, ids = updateDesktopFiles(paths)
+		patchAppGrid(ids)
+		for _, id := range ids {
+			if pins.Contains(id) {
+				pinnedFlowBox = setUpPinnedFlowBox()
+				break
+			}
+		}
+	}
+	if statusLabel != nil {
+		statusLabel.SetText(status)
+	}
+
+	fullRefreshNeeded = false
+	changedDesktopFiles = make(map[string]bool)
+	desktopTrigger = false
+}
+
+// isReloadable tells if the file is one of these we re-read on the fly
+func isReloadable(path string) bool {
+	if path == *cssFileName {
+		return true
+	}
+	if filepath.Dir(path) != configDirectory {
+		return false
+	}
+	return isIn([]string{"preferred-apps.json", "excluded-dirs", "search-roots.json", "terminals.json",
+		"config.json"}, filepath.Base(path))
+}
+
+// We wait for the editor to finish saving, before we read the file
+const reloadDelay = 300
+
+var (
+	pendingReloads   = make(map[string]bool)
+	reloadsScheduled uint
+)
+
+// scheduleReload collects changed files, and reloads them once things calm down. Must be called on the main loop.
+func scheduleReload(path string) {
+	pendingReloads[path] = true
+	reloadsScheduled++
+	current := reloadsScheduled
+	glib.TimeoutAdd(reloadDelay, func() bool {
+		if current == reloadsScheduled {
+			for p := range pendingReloads {
+				if err := reloadFile(p); err != nil {
+					log.Errorf("Couldn't reload %s: %s", p, err)
+					if statusLabel != nil {
+						statusLabel.SetText(fmt.Sprintf("Error in %s: %s", filepath.Base(p), err))
+					}
+				}
+			}
+			pendingReloads = make(map[string]bool)
+		}
+		return false
+	})
+}
+
+// reloadFile re-reads a changed file. If it's broken, whatever we've loaded previously stays in use.
+func reloadFile(path string) error {
+	if !pathExists(path) {
+		// being replaced, or removed on purpose; we'll keep what we have
+		return nil
+	}
+
+	if path == *cssFileName {
+		if err := loadCSS(path); err != nil {
+			return err
+		}
+		log.Infof("Style reloaded from %s", path)
+		return nil
+	}
+
+	switch filepath.Base(path) {
+	case "preferred-apps.json":
+		apps, err := loadPreferredApps(path)
+		if err != nil {
+			return err
+		}
+		preferredApps = apps
+		log.Infof("Reloaded %v associations from %s", len(apps), path)
+
+	case "excluded-dirs":
+		lines, err := loadTextFile(path)
+		if err != nil {
+			return err
+		}
+		exclusions = lines
+		log.Infof("Reloaded %v search exclusions from %s", len(lines), path)
+		startFileIndex()
+
+	case "search-roots.json":
+		roots, err := loadSearchRoots(path)
+		if err != nil {
+			return err
+		}
+		searchRoots = roots
+		log.Infof("Reloaded %v search roots from %s", len(roots), path)
+		startFileIndex()
+
+	case "terminals.json":
+		return loadTerminalProfiles(path)
+
+	case "config.json":
+		log.Infof("%s changed, restart the drawer to apply the new arguments", path)
+	}
+	return nil
+}
+
+// loadCSS replaces the style provider with a new one, loaded from the path. On error, the old one stays in place.
+func loadCSS(path string) error {
+	provider := gtk.NewCSSProvider()
+	if err := provider.LoadFromPath(path); err != nil {
+		return err
+	}
+
+	screen := gdk.ScreenGetDefault()
+	if cssProvider != nil {
+		gtk.StyleContextRemoveProviderForScreen(screen, cssProvider)
 	}
+	gtk.StyleContextAddProviderForScreen(screen, provider, gtk.STYLE_PROVIDER_PRIORITY_APPLICATION)
+	cssProvider = provider
 
 	return nil
 }
@@ -27,14 +27,42 @@ func parseDesktopEntry(id string, in io.Reader) (entry desktopEntry, err error)
 	scanner := bufio.NewScanner(in)
 	scanner.Split(bufio.ScanLines)
 
+	var actionIDs []string
+	var actions []desktopAction
+	// index of the [Desktop Action <id>] group being parsed; -1 for [Desktop Entry], -2 for unknown groups
+	current := -1
+
 	for scanner.Scan() {
 		l := scanner.Text()
-		if strings.HasPrefix(l, "[") && l != "[Desktop Entry]" {
-			break
+		if strings.HasPrefix(l, "[") {
+			if l == "[Desktop Entry]" {
+				current = -1
+			} else if strings.HasPrefix(l, "[Desktop Action ") && strings.HasSuffix(l, "]") {
+				actions = append(actions, desktopAction{ID: l[len("[Desktop Action ") : len(l)-1]})
+				current = len(actions) - 1
+			} else {
+				current = -2
+			}
+			continue
 		}
 
 		name, value := parseKeypair(l)
-		if value == "" {
+		if value == "" || current == -2 {
+			continue
+		}
+
+		if current >= 0 {
+			action := &actions[current]
+			switch name {
+			case "Name":
+				action.Name = value
+			case localizedName:
+				action.NameLoc = value
+			case "Icon":
+				action.Icon = value
+			case "Exec":
+				action.Exec = cleanexec.Replace(value)
+			}
 			continue
 		}
 
@@ -53,6 +81,16 @@ func parseDesktopEntry(id string, in io.Reader) (entry desktopEntry, err error)
 			entry.Category = value
 		case "Terminal":
 			entry.Terminal, _ = strconv.ParseBool(value)
+		case "StartupNotify":
+			entry.StartupNotify, _ = strconv.ParseBool(value)
+		case "DBusActivatable":
+			entry.DBusActivatable, _ = strconv.ParseBool(value)
+		case "Actions":
+			for _, id := range strings.Split(value, ";") {
+				if id = strings.TrimSpace(id); id != "" {
+					actionIDs = append(actionIDs, id)
+				}
+			}
 		case "NoDisplay":
 			if !entry.NoDisplay {
 				entry.NoDisplay, _ = strconv.ParseBool(value)
@@ -87,6 +125,19 @@ func parseDesktopEntry(id string, in io.Reader) (entry desktopEntry, err error)
 		}
 	}
 
+	// Only actions listed in the Actions key are valid, in the order given there
+	for _, id := range actionIDs {
+		for _, action := range actions {
+			if action.ID == id && action.Name != "" {
+				if action.NameLoc == "" {
+					action.NameLoc = action.Name
+				}
+				entry.Actions = append(entry.Actions, action)
+				break
+			}
+		}
+	}
+
 	// if name[ln] not found, let's try to find name[ln_LN]
 	if entry.NameLoc == "" {
 		entry.NameLoc = entry.Name
@@ -50,4 +50,55 @@ func TestWhitespaceHandling(t *testing.T) {
 	if entry.NoDisplay {
 		t.Error("failed to parse desktop entry no display")
 	}
+
+	if !entry.StartupNotify {
+		t.Error("failed to parse desktop entry startup notify")
+	}
+}
+
+func TestDesktopActions(t *testing.T) {
+	const actions = `[Desktop Entry]
+Name=Web Browser
+Exec=browser %u
+DBusActivatable=true
+Actions=new-window;new-private-window;
+
+[Desktop Action new-private-window]
+Name=New Private Window
+Name[pl]=Nowe okno prywatne
+Exec=browser --private-window
+
+[Desktop Action new-window]
+Name=New Window
+Exec=browser --new-window
+
+[Desktop Action not-listed]
+Name=Not Listed
+Exec=browser --not-listed`
+
+	*lang = "pl"
+	entry, err := parseDesktopEntry("id", strings.NewReader(actions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !entry.DBusActivatable {
+		t.Error("failed to parse desktop entry dbus activatable")
+	}
+
+	if entry.Exec != "browser %u" {
+		t.Errorf("action group overrode entry exec: %q", entry.Exec)
+	}
+
+	if len(entry.Actions) != 2 {
+		t.Fatalf("expected 2 actions, got %d", len(entry.Actions))
+	}
+
+	if entry.Actions[0].ID != "new-window" || entry.Actions[0].NameLoc != "New Window" {
+		t.Errorf("unexpected first action: %+v", entry.Actions[0])
+	}
+
+	if entry.Actions[1].Exec != "browser --private-window" || entry.Actions[1].NameLoc != "Nowe okno prywatne" {
+		t.Errorf("unexpected second action: %+v", entry.Actions[1])
+	}
 }